@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	stderr "errors"
+	"fmt"
+	"os"
+
+	"github.com/iden3/reverse-hash-service/auth"
+	"github.com/spf13/viper"
+)
+
+// apiKey adds or revokes API keys in the api_key database table
+func apiKey(v *viper.Viper, args []string) int {
+	if len(args) != 2 || (args[0] != "add" && args[0] != "revoke") {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	action, name := args[0], args[1]
+
+	conn := setupPgPool(v)
+	defer conn.Close()
+	ctx := context.Background()
+
+	if action == "revoke" {
+		err := auth.RevokePgKey(ctx, conn, name)
+		if stderr.Is(err, auth.ErrUnknownKey) {
+			fmt.Fprintf(os.Stderr, "no active key named %v\n", name)
+			return 1
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "revoke failed: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	key, err := auth.AddPgKey(ctx, conn, name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "add failed: %v\n", err)
+		return 1
+	}
+	// the key can't be shown again, only its hash is stored
+	fmt.Println(key)
+	return 0
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/reverse-hash-service/hashdb"
+	"github.com/spf13/viper"
+)
+
+// audit walks trees with given roots and prints found problems. Returns 1 if
+// any tree is broken.
+func audit(v *viper.Viper, roots []string) int {
+	if len(roots) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	rootHashes, err := parseRoots(roots)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	s := setupStorage(v)
+	defer s.close()
+	storage := s.nodes
+
+	exitCode := 0
+	for _, root := range rootHashes {
+		report, err := hashdb.AuditTree(context.Background(), storage, root)
+		if err != nil {
+			panic(fmt.Sprintf("%+v", err))
+		}
+		printAuditReport(report)
+		if !report.OK() {
+			exitCode = 1
+		}
+	}
+	return exitCode
+}
+
+func printAuditReport(r hashdb.AuditReport) {
+	status := "OK"
+	if !r.OK() {
+		status = "BROKEN"
+	}
+	fmt.Printf("%v: %v, nodes: %v, max depth: %v\n", r.Root.Hex(), status,
+		r.Nodes, r.MaxDepth)
+	printHashes("missing node", r.Missing)
+	printHashes("invalid hash", r.Invalid)
+	printHashes("cycle", r.Cycles)
+}
+
+func printHashes(title string, hashes []merkletree.Hash) {
+	for _, h := range hashes {
+		fmt.Printf("  %v: %v\n", title, h.Hex())
+	}
+}
@@ -0,0 +1,140 @@
+// Package auth looks up API keys that authorize write requests.
+//
+// Keys are compared by their SHA-256 hashes, so neither the configuration nor
+// the database needs to keep keys in plain text longer than necessary.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	stderr "errors"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+)
+
+// ErrUnknownKey is returned for keys that do not exist or are revoked.
+var ErrUnknownKey = stderr.New("unknown API key")
+
+// Keys looks up names of API keys.
+type Keys interface {
+	// KeyName returns the name of the key or ErrUnknownKey
+	KeyName(ctx context.Context, key string) (string, error)
+}
+
+func hashKey(key string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(key))
+}
+
+type staticKeys map[[sha256.Size]byte]string
+
+// ParseKeys parses keys from a list of comma separated name:key pairs, e.g.
+// "issuer-1:secret1,issuer-2:secret2".
+func ParseKeys(s string) (Keys, error) {
+	keys := make(staticKeys)
+	for i, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, key, ok := strings.Cut(pair, ":")
+		if !ok || name == "" || key == "" {
+			// the pair is not printed, it may be a key
+			return nil, errors.Errorf(
+				"API key #%v should be in name:key format", i+1)
+		}
+		h := hashKey(key)
+		if _, ok := keys[h]; ok {
+			return nil, errors.Errorf("duplicate API key of %v", name)
+		}
+		keys[h] = name
+	}
+	return keys, nil
+}
+
+func (k staticKeys) KeyName(_ context.Context, key string) (string, error) {
+	name, ok := k[hashKey(key)]
+	if !ok {
+		return "", errors.WithStack(ErrUnknownKey)
+	}
+	return name, nil
+}
+
+type dbI interface {
+	Exec(ctx context.Context,
+		sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+type pgKeys struct {
+	db dbI
+}
+
+// NewPgKeys looks up keys in the api_key table.
+func NewPgKeys(db dbI) Keys {
+	return &pgKeys{db}
+}
+
+func (p *pgKeys) KeyName(ctx context.Context, key string) (string, error) {
+	h := hashKey(key)
+	var name string
+	err := p.db.QueryRow(ctx, `
+SELECT name FROM api_key WHERE key_hash = $1 AND revoked_at IS NULL`,
+		h[:]).Scan(&name)
+	if err == pgx.ErrNoRows {
+		return "", errors.WithStack(ErrUnknownKey)
+	}
+	return name, errors.WithStack(err)
+}
+
+// AddPgKey generates a new key with given name and stores its hash in the
+// api_key table. The key is returned once and can't be recovered later.
+func AddPgKey(ctx context.Context, db dbI, name string) (string, error) {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", errors.WithStack(err)
+	}
+	key := hex.EncodeToString(b[:])
+	h := hashKey(key)
+	_, err := db.Exec(ctx,
+		`INSERT INTO api_key (name, key_hash) VALUES ($1, $2)`, name, h[:])
+	if err != nil {
+		return "", errors.Wrapf(err, "error adding key %v", name)
+	}
+	return key, nil
+}
+
+// RevokePgKey revokes the active key with given name.
+func RevokePgKey(ctx context.Context, db dbI, name string) error {
+	tag, err := db.Exec(ctx, `
+UPDATE api_key SET revoked_at = now()
+WHERE name = $1 AND revoked_at IS NULL`, name)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.WithStack(ErrUnknownKey)
+	}
+	return nil
+}
+
+type chainKeys []Keys
+
+// Chain looks up a key in keys in order and returns the first found name.
+func Chain(keys ...Keys) Keys {
+	return chainKeys(keys)
+}
+
+func (c chainKeys) KeyName(ctx context.Context, key string) (string, error) {
+	for _, k := range c {
+		name, err := k.KeyName(ctx, key)
+		if !stderr.Is(err, ErrUnknownKey) {
+			return name, err
+		}
+	}
+	return "", errors.WithStack(ErrUnknownKey)
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	go_test_pg "github.com/olomix/go-test-pg"
+	"github.com/stretchr/testify/require"
+)
+
+var dbtest = go_test_pg.Pgpool{
+	BaseName:   "rhs",
+	SchemaFile: "../schema.sql",
+	Skip:       false,
+}
+
+func TestParseKeys(t *testing.T) {
+	ctx := context.Background()
+	keys, err := ParseKeys(" alice:key1, bob:key:2,")
+	require.NoError(t, err)
+
+	name, err := keys.KeyName(ctx, "key1")
+	require.NoError(t, err)
+	require.Equal(t, "alice", name)
+	name, err = keys.KeyName(ctx, "key:2")
+	require.NoError(t, err)
+	require.Equal(t, "bob", name)
+	_, err = keys.KeyName(ctx, "alice")
+	require.ErrorIs(t, err, ErrUnknownKey)
+
+	_, err = ParseKeys("alice:key1,secret")
+	require.EqualError(t, err, "API key #2 should be in name:key format")
+	_, err = ParseKeys("alice:key1,bob:key1")
+	require.EqualError(t, err, "duplicate API key of bob")
+}
+
+func TestChain(t *testing.T) {
+	ctx := context.Background()
+	k1, err := ParseKeys("alice:key1")
+	require.NoError(t, err)
+	k2, err := ParseKeys("bob:key2")
+	require.NoError(t, err)
+	keys := Chain(k1, k2)
+
+	name, err := keys.KeyName(ctx, "key2")
+	require.NoError(t, err)
+	require.Equal(t, "bob", name)
+	_, err = keys.KeyName(ctx, "key3")
+	require.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestPgKeys(t *testing.T) {
+	db := dbtest.WithEmpty(t)
+	ctx := context.Background()
+	keys := NewPgKeys(db)
+
+	key, err := AddPgKey(ctx, db, "alice")
+	require.NoError(t, err)
+	_, err = AddPgKey(ctx, db, "alice")
+	require.Error(t, err)
+
+	name, err := keys.KeyName(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, "alice", name)
+
+	require.NoError(t, RevokePgKey(ctx, db, "alice"))
+	_, err = keys.KeyName(ctx, key)
+	require.ErrorIs(t, err, ErrUnknownKey)
+	require.ErrorIs(t, RevokePgKey(ctx, db, "alice"), ErrUnknownKey)
+
+	// the name can be used again after the key is revoked
+	key2, err := AddPgKey(ctx, db, "alice")
+	require.NoError(t, err)
+	require.NotEqual(t, key, key2)
+	name, err = keys.KeyName(ctx, key2)
+	require.NoError(t, err)
+	require.Equal(t, "alice", name)
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// KeyIdentities maps names of API keys to identities they may publish
+// states for.
+type KeyIdentities map[string]map[string]struct{}
+
+// ParseKeyIdentities parses a list of comma separated name:identity pairs.
+// A key name may be repeated to allow several identities.
+func ParseKeyIdentities(s string) (KeyIdentities, error) {
+	ki := make(KeyIdentities)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		// identities may contain colons, key names never do
+		name, identity, ok := strings.Cut(pair, ":")
+		if !ok || name == "" || identity == "" {
+			return nil, errors.Errorf(
+				"key identity should be in name:identity format: %q", pair)
+		}
+		if ki[name] == nil {
+			ki[name] = make(map[string]struct{})
+		}
+		ki[name][identity] = struct{}{}
+	}
+	return ki, nil
+}
+
+// Allowed reports if the API key with name may publish states of identity.
+func (ki KeyIdentities) Allowed(name, identity string) bool {
+	_, ok := ki[name][identity]
+	return ok
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"context"
+	stderr "errors"
+	"math/big"
+	"strings"
+
+	"github.com/iden3/go-iden3-crypto/babyjub"
+	"github.com/iden3/go-iden3-crypto/poseidon"
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/reverse-hash-service/hashdb"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrUnknownIdentity is returned for identities without a signing key.
+	ErrUnknownIdentity = stderr.New("unknown identity")
+	// ErrInvalidSignature is returned when a signature does not match.
+	ErrInvalidSignature = stderr.New("invalid signature")
+)
+
+// SigningKeys looks up BabyJubJub public keys that identities sign node
+// submissions with.
+type SigningKeys interface {
+	// PublicKey returns the key of identity or ErrUnknownIdentity
+	PublicKey(ctx context.Context,
+		identity string) (*babyjub.PublicKey, error)
+}
+
+type staticSigningKeys map[string]*babyjub.PublicKey
+
+// ParseSigningKeys parses keys from a list of comma separated identity:key
+// pairs, where key is a hex encoded compressed BabyJubJub public key.
+func ParseSigningKeys(s string) (SigningKeys, error) {
+	keys := make(staticSigningKeys)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		// identities may contain colons, keys never do
+		i := strings.LastIndex(pair, ":")
+		if i <= 0 {
+			return nil, errors.Errorf(
+				"signing key should be in identity:key format: %q", pair)
+		}
+		identity, hexKey := pair[:i], pair[i+1:]
+		var keyComp babyjub.PublicKeyComp
+		if err := keyComp.UnmarshalText([]byte(hexKey)); err != nil {
+			return nil, errors.Wrapf(err, "invalid signing key of %v",
+				identity)
+		}
+		key, err := keyComp.Decompress()
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid signing key of %v",
+				identity)
+		}
+		keys[identity] = key
+	}
+	return keys, nil
+}
+
+func (k staticSigningKeys) PublicKey(_ context.Context,
+	identity string) (*babyjub.PublicKey, error) {
+
+	key, ok := k[identity]
+	if !ok {
+		return nil, errors.WithStack(ErrUnknownIdentity)
+	}
+	return key, nil
+}
+
+// NodesMessage returns the message that is signed to submit nodes. It is a
+// chain of Poseidon hashes over node hashes in the order of submission:
+//
+//	m0 = 0
+//	mi = Poseidon(m(i-1), hash of node i)
+func NodesMessage(nodes []hashdb.Node) (*big.Int, error) {
+	m := big.NewInt(0)
+	for i := range nodes {
+		var err error
+		m, err = poseidon.Hash([]*big.Int{m, nodes[i].Hash.BigInt()})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return m, nil
+}
+
+// VerifyNodes checks that nodes are signed by key. sig is a hex encoded
+// compressed signature of NodesMessage with Poseidon EdDSA.
+func VerifyNodes(key *babyjub.PublicKey, nodes []hashdb.Node,
+	sig string) error {
+
+	m, err := NodesMessage(nodes)
+	if err != nil {
+		return err
+	}
+	return verify(key, m, sig)
+}
+
+// StateMessage returns the message that is signed to publish state of an
+// identity. It is Poseidon(1, state), so it never matches NodesMessage.
+func StateMessage(state merkletree.Hash) (*big.Int, error) {
+	m, err := poseidon.Hash([]*big.Int{big.NewInt(1), state.BigInt()})
+	return m, errors.WithStack(err)
+}
+
+// VerifyState checks that state is signed by key. sig is a hex encoded
+// compressed signature of StateMessage with Poseidon EdDSA.
+func VerifyState(key *babyjub.PublicKey, state merkletree.Hash,
+	sig string) error {
+
+	m, err := StateMessage(state)
+	if err != nil {
+		return err
+	}
+	return verify(key, m, sig)
+}
+
+func verify(key *babyjub.PublicKey, m *big.Int, sig string) error {
+	var sigComp babyjub.SignatureComp
+	if err := sigComp.UnmarshalText([]byte(sig)); err != nil {
+		return errors.WithStack(ErrInvalidSignature)
+	}
+	signature, err := sigComp.Decompress()
+	if err != nil {
+		return errors.WithStack(ErrInvalidSignature)
+	}
+	if !key.VerifyPoseidon(m, signature) {
+		return errors.WithStack(ErrInvalidSignature)
+	}
+	return nil
+}
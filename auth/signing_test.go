@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/iden3/go-iden3-crypto/babyjub"
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/reverse-hash-service/hashdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyNodes(t *testing.T) {
+	ctx := context.Background()
+	const identity = "114vgnnCupQMX4wqUBjg5kUya3zMXfPmKc9HNH4TSE"
+	privKey := babyjub.NewRandPrivKey()
+	keys, err := ParseSigningKeys(" " + identity + ":" +
+		privKey.Public().Compress().String() + ",")
+	require.NoError(t, err)
+	pubKey, err := keys.PublicKey(ctx, identity)
+	require.NoError(t, err)
+	_, err = keys.PublicKey(ctx, "other")
+	require.ErrorIs(t, err, ErrUnknownIdentity)
+
+	nodes := []hashdb.Node{
+		{Hash: merkletree.Hash{1}}, {Hash: merkletree.Hash{2}}}
+	m, err := NodesMessage(nodes)
+	require.NoError(t, err)
+	sig := privKey.SignPoseidon(m).Compress().String()
+
+	require.NoError(t, VerifyNodes(pubKey, nodes, sig))
+	// order of nodes matters
+	require.ErrorIs(t,
+		VerifyNodes(pubKey, []hashdb.Node{nodes[1], nodes[0]}, sig),
+		ErrInvalidSignature)
+	require.ErrorIs(t, VerifyNodes(pubKey, nodes[:1], sig),
+		ErrInvalidSignature)
+	require.ErrorIs(t, VerifyNodes(pubKey, nodes, "xyz"),
+		ErrInvalidSignature)
+
+	otherKey := babyjub.NewRandPrivKey()
+	require.ErrorIs(t, VerifyNodes(otherKey.Public(), nodes, sig),
+		ErrInvalidSignature)
+}
+
+func TestParseSigningKeys_Errors(t *testing.T) {
+	_, err := ParseSigningKeys("abc")
+	require.EqualError(t, err,
+		`signing key should be in identity:key format: "abc"`)
+	_, err = ParseSigningKeys("abc:zz")
+	require.Error(t, err)
+}
+
+func TestVerifyState(t *testing.T) {
+	privKey := babyjub.NewRandPrivKey()
+	state := merkletree.Hash{1}
+	m, err := StateMessage(state)
+	require.NoError(t, err)
+	sig := privKey.SignPoseidon(m).Compress().String()
+
+	require.NoError(t, VerifyState(privKey.Public(), state, sig))
+	require.ErrorIs(t, VerifyState(privKey.Public(), merkletree.Hash{2}, sig),
+		ErrInvalidSignature)
+
+	// a signature of nodes can't be used to publish a state
+	m, err = NodesMessage([]hashdb.Node{{Hash: state}})
+	require.NoError(t, err)
+	sig = privKey.SignPoseidon(m).Compress().String()
+	require.ErrorIs(t, VerifyState(privKey.Public(), state, sig),
+		ErrInvalidSignature)
+}
+
+func TestParseKeyIdentities(t *testing.T) {
+	ki, err := ParseKeyIdentities(
+		"issuer-1:did:iden3:x1, issuer-1:did:iden3:x2,issuer-2:did:iden3:x3")
+	require.NoError(t, err)
+	require.True(t, ki.Allowed("issuer-1", "did:iden3:x1"))
+	require.True(t, ki.Allowed("issuer-1", "did:iden3:x2"))
+	require.False(t, ki.Allowed("issuer-1", "did:iden3:x3"))
+	require.False(t, ki.Allowed("issuer-3", "did:iden3:x1"))
+
+	_, err = ParseKeyIdentities("issuer-1")
+	require.EqualError(t, err,
+		`key identity should be in name:identity format: "issuer-1"`)
+}
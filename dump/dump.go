@@ -0,0 +1,230 @@
+// Package dump reads and writes portable dumps of merkle tree nodes.
+//
+// A dump is a text file of newline-delimited JSON objects. The first line is
+// a header:
+//
+//	{"format":"rhs-dump","version":1,"created_at":"...","roots":["<hash>"]}
+//
+// It is followed by one line per node in the same format as nodes are
+// submitted to POST /node. The last line is a trailer:
+//
+//	{"count":2,"checksum":"sha256:<hex>"}
+//
+// where count is the number of nodes and checksum is SHA-256 of all node
+// lines including their newline characters.
+package dump
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	stderr "errors"
+	"hash"
+	"io"
+	"time"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/reverse-hash-service/hashdb"
+	"github.com/pkg/errors"
+)
+
+const (
+	Format  = "rhs-dump"
+	Version = 1
+)
+
+const checksumPrefix = "sha256:"
+
+// maximum length of one line in a dump
+const maxLineSize = 64 * 1024
+
+// ErrChecksum is returned when the trailer does not match the read nodes.
+var ErrChecksum = stderr.New("dump checksum mismatch")
+
+// Header is the first line of a dump.
+type Header struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	// hex encoded hashes of roots the dump was made from, empty if all nodes
+	// were dumped
+	Roots []string `json:"roots,omitempty"`
+}
+
+type trailer struct {
+	Count    *int    `json:"count"`
+	Checksum *string `json:"checksum"`
+}
+
+// Writer writes nodes to a dump. Close must be called to write the trailer.
+type Writer struct {
+	w     *bufio.Writer
+	hash  hash.Hash
+	count int
+}
+
+// NewWriter writes the dump header to w. roots are recorded in the header to
+// tell what the dump was made from.
+func NewWriter(w io.Writer, roots []merkletree.Hash) (*Writer, error) {
+	h := Header{Format: Format, Version: Version, CreatedAt: time.Now().UTC()}
+	for i := range roots {
+		h.Roots = append(h.Roots, roots[i].Hex())
+	}
+
+	dw := &Writer{w: bufio.NewWriter(w), hash: sha256.New()}
+	if err := dw.writeLine(h); err != nil {
+		return nil, err
+	}
+	return dw, nil
+}
+
+func (w *Writer) Write(n hashdb.Node) error {
+	line, err := json.Marshal(n)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	line = append(line, '\n')
+	_, _ = w.hash.Write(line)
+	w.count++
+	_, err = w.w.Write(line)
+	return errors.WithStack(err)
+}
+
+// Count returns the number of nodes written
+func (w *Writer) Count() int {
+	return w.count
+}
+
+// Close writes the trailer and flushes buffered data. The underlying writer
+// is not closed.
+func (w *Writer) Close() error {
+	checksum := checksumPrefix + hex.EncodeToString(w.hash.Sum(nil))
+	err := w.writeLine(trailer{Count: &w.count, Checksum: &checksum})
+	if err != nil {
+		return err
+	}
+	return errors.WithStack(w.w.Flush())
+}
+
+func (w *Writer) writeLine(obj interface{}) error {
+	line, err := json.Marshal(obj)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = w.w.Write(append(line, '\n'))
+	return errors.WithStack(err)
+}
+
+// Reader reads nodes from a dump. Every node is validated when read.
+type Reader struct {
+	s      *bufio.Scanner
+	header Header
+	hash   hash.Hash
+	count  int
+	line   int
+	done   bool
+}
+
+// NewReader reads and checks the dump header.
+func NewReader(r io.Reader) (*Reader, error) {
+	dr := &Reader{s: bufio.NewScanner(r), hash: sha256.New()}
+	dr.s.Buffer(nil, maxLineSize)
+
+	line, err := dr.next()
+	if err == io.EOF {
+		return nil, errors.New("dump is empty")
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(line, &dr.header); err != nil {
+		return nil, errors.Wrap(err, "error parsing dump header")
+	}
+	if dr.header.Format != Format {
+		return nil, errors.Errorf("unexpected dump format: %q",
+			dr.header.Format)
+	}
+	if dr.header.Version != Version {
+		return nil, errors.Errorf("unsupported dump version: %v",
+			dr.header.Version)
+	}
+	return dr, nil
+}
+
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// Read returns the next node. After the last node the trailer is checked
+// and io.EOF is returned. If the dump ends without a trailer or the trailer
+// does not match read nodes, an error is returned instead of io.EOF.
+func (r *Reader) Read() (hashdb.Node, error) {
+	if r.done {
+		return hashdb.Node{}, io.EOF
+	}
+
+	line, err := r.next()
+	if err == io.EOF {
+		return hashdb.Node{}, errors.New(
+			"unexpected end of dump: trailer is missing")
+	} else if err != nil {
+		return hashdb.Node{}, err
+	}
+
+	var t trailer
+	if err = json.Unmarshal(line, &t); err == nil && t.Checksum != nil {
+		return hashdb.Node{}, r.checkTrailer(t)
+	}
+
+	var n hashdb.Node
+	if err = json.Unmarshal(line, &n); err == nil {
+		err = n.Validate()
+	}
+	if err != nil {
+		return n, errors.Wrapf(err, "line %v", r.line)
+	}
+	_, _ = r.hash.Write(line)
+	_, _ = r.hash.Write([]byte{'\n'})
+	r.count++
+	return n, nil
+}
+
+func (r *Reader) checkTrailer(t trailer) error {
+	checksum := checksumPrefix + hex.EncodeToString(r.hash.Sum(nil))
+	if *t.Checksum != checksum {
+		return errors.WithStack(ErrChecksum)
+	}
+	if t.Count == nil {
+		return errors.New("dump trailer has no count")
+	}
+	if *t.Count != r.count {
+		return errors.Errorf("dump should have %v nodes, but %v read",
+			*t.Count, r.count)
+	}
+
+	if _, err := r.next(); err != io.EOF {
+		if err == nil {
+			return errors.Errorf("line %v: unexpected data after trailer",
+				r.line)
+		}
+		return err
+	}
+	r.done = true
+	return io.EOF
+}
+
+// next returns the next non-empty line
+func (r *Reader) next() ([]byte, error) {
+	for r.s.Scan() {
+		r.line++
+		line := bytes.TrimSpace(r.s.Bytes())
+		if len(line) != 0 {
+			return line, nil
+		}
+	}
+	if err := r.s.Err(); err != nil {
+		return nil, errors.Wrapf(err, "line %v", r.line+1)
+	}
+	return nil, io.EOF
+}
@@ -0,0 +1,164 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/reverse-hash-service/hashdb"
+	"github.com/stretchr/testify/require"
+)
+
+func mkNode(t testing.TB, hash string, children ...string) hashdb.Node {
+	var n hashdb.Node
+	_, err := hex.Decode(n.Hash[:], []byte(hash))
+	require.NoError(t, err)
+	n.Children = make([]merkletree.Hash, len(children))
+	for i := range children {
+		_, err = hex.Decode(n.Children[i][:], []byte(children[i]))
+		require.NoError(t, err)
+	}
+	return n
+}
+
+var (
+	middleNode = `{"children":["658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e","e809a4ed2cf98922910e456f1e56862bb958777f5ff0ea6799360113257f220f"],"hash":"2c32381aebce52c0c5c5a1fb92e726f66d977b58a1c8a0c14bb31ef968187325","type":"middle"}`
+	leafNode   = `{"children":["037c4d7bbb0407b8000000000000000000000000000000000000000000000000","0000000000000000000000000000000000000000000000000000000000000000","0100000000000000000000000000000000000000000000000000000000000000"],"hash":"658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e","type":"leaf"}`
+)
+
+func testNodes(t testing.TB) []hashdb.Node {
+	return []hashdb.Node{
+		mkNode(t,
+			"2c32381aebce52c0c5c5a1fb92e726f66d977b58a1c8a0c14bb31ef968187325",
+			"658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e",
+			"e809a4ed2cf98922910e456f1e56862bb958777f5ff0ea6799360113257f220f"),
+		mkNode(t,
+			"658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e",
+			"037c4d7bbb0407b8000000000000000000000000000000000000000000000000",
+			"0000000000000000000000000000000000000000000000000000000000000000",
+			"0100000000000000000000000000000000000000000000000000000000000000"),
+	}
+}
+
+func readAll(r *Reader) ([]hashdb.Node, error) {
+	var nodes []hashdb.Node
+	for {
+		n, err := r.Read()
+		if err == io.EOF {
+			return nodes, nil
+		} else if err != nil {
+			return nodes, err
+		}
+		nodes = append(nodes, n)
+	}
+}
+
+func TestWriterReader(t *testing.T) {
+	nodes := testNodes(t)
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, []merkletree.Hash{nodes[0].Hash})
+	require.NoError(t, err)
+	for _, n := range nodes {
+		require.NoError(t, w.Write(n))
+	}
+	require.NoError(t, w.Close())
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 4)
+	require.Equal(t, middleNode, lines[1])
+	require.Equal(t, leafNode, lines[2])
+	require.Equal(t, `{"count":2,"checksum":"sha256:`+
+		`c80d708f7f4e1a476cfc038fe8934c7043d46c709c3989e4f75e9bafdb9b218e"}`,
+		lines[3])
+
+	r, err := NewReader(&buf)
+	require.NoError(t, err)
+	require.Equal(t, Format, r.Header().Format)
+	require.Equal(t, []string{nodes[0].Hash.Hex()}, r.Header().Roots)
+	got, err := readAll(r)
+	require.NoError(t, err)
+	require.Equal(t, nodes, got)
+	// EOF is sticky
+	_, err = r.Read()
+	require.Equal(t, io.EOF, err)
+}
+
+func TestReader_Errors(t *testing.T) {
+	const header = `{"format":"rhs-dump","version":1,"created_at":"2022-01-01T00:00:00Z"}`
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, nil)
+	require.NoError(t, err)
+	for _, n := range testNodes(t) {
+		require.NoError(t, w.Write(n))
+	}
+	require.NoError(t, w.Close())
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	trailer := lines[3]
+
+	testCases := []struct {
+		title     string
+		in        string
+		wantNodes int
+		wantErr   string
+	}{
+		{
+			title:   "empty",
+			in:      "\n",
+			wantErr: "dump is empty",
+		},
+		{
+			title:   "wrong format",
+			in:      `{"format":"pg_dump","version":1}`,
+			wantErr: `unexpected dump format: "pg_dump"`,
+		},
+		{
+			title:   "wrong version",
+			in:      `{"format":"rhs-dump","version":2}`,
+			wantErr: "unsupported dump version: 2",
+		},
+		{
+			title:     "truncated",
+			in:        header + "\n" + middleNode + "\n",
+			wantNodes: 1,
+			wantErr:   "unexpected end of dump: trailer is missing",
+		},
+		{
+			title:     "missing node",
+			in:        header + "\n" + middleNode + "\n" + trailer + "\n",
+			wantNodes: 1,
+			wantErr:   "dump checksum mismatch",
+		},
+		{
+			title: "invalid node",
+			in: header + "\n" + middleNode + "\n\n" +
+				strings.Replace(leafNode, "037c", "047c", 1) + "\n" +
+				trailer + "\n",
+			wantNodes: 1,
+			wantErr:   "line 4: node hash is not correct",
+		},
+		{
+			title: "data after trailer",
+			in: header + "\n" + middleNode + "\n" + leafNode + "\n" +
+				trailer + "\n" + leafNode + "\n",
+			wantNodes: 2,
+			wantErr:   "line 5: unexpected data after trailer",
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.title, func(t *testing.T) {
+			r, err := NewReader(strings.NewReader(tc.in))
+			if err != nil {
+				require.EqualError(t, err, tc.wantErr)
+				return
+			}
+			nodes, err := readAll(r)
+			require.EqualError(t, err, tc.wantErr)
+			require.Len(t, nodes, tc.wantNodes)
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/reverse-hash-service/dump"
+	"github.com/iden3/reverse-hash-service/hashdb"
+	"github.com/iden3/reverse-hash-service/log"
+	"github.com/spf13/viper"
+)
+
+// number of nodes saved at once by import
+const importChunkSize = 1000
+
+// exportNodes writes all nodes or nodes reachable from given roots to a dump
+func exportNodes(v *viper.Viper, args []string) int {
+	fs := flag.NewFlagSet(cmdExport, flag.ContinueOnError)
+	outFile := fs.String("o", "", "output file, stdout by default")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	roots, err := parseRoots(fs.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	s := setupStorage(v)
+	defer s.close()
+	storage := s.nodes
+
+	var out io.Writer = os.Stdout
+	var f *os.File
+	if *outFile != "" {
+		f, err = os.Create(*outFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer func() { _ = f.Close() }()
+		out = f
+	}
+
+	ctx := context.Background()
+	dw, err := dump.NewWriter(out, roots)
+	if err == nil {
+		if len(roots) == 0 {
+			err = storage.ForEach(ctx, dw.Write)
+		} else {
+			var missing []merkletree.Hash
+			missing, err = hashdb.WalkTrees(ctx, storage, roots, dw.Write)
+			for _, h := range missing {
+				log.Warnf("node %v is missing from storage", h.Hex())
+			}
+		}
+	}
+	if err == nil {
+		err = dw.Close()
+	}
+	if err == nil && f != nil {
+		err = f.Close()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export failed: %v\n", err)
+		return 1
+	}
+
+	log.Infof("Exported %v nodes", dw.Count())
+	return 0
+}
+
+// importNodes loads nodes from a dump. Nodes are saved in chunks as they are
+// read, so if the dump turns out to be broken, nodes read before the error
+// stay saved. They are valid nodes anyway, as every node is checked when
+// read.
+func importNodes(v *viper.Viper, args []string) int {
+	fs := flag.NewFlagSet(cmdImport, flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var in io.Reader = os.Stdin
+	if fs.NArg() > 0 {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer func() { _ = f.Close() }()
+		in = f
+	}
+
+	dr, err := dump.NewReader(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import failed: %v\n", err)
+		return 1
+	}
+
+	s := setupStorage(v)
+	defer s.close()
+	storage := s.nodes
+
+	ctx := context.Background()
+	var read, inserted int
+	chunk := make([]hashdb.Node, 0, importChunkSize)
+	save := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		chunkInserted, err := storage.SaveNodes(ctx, chunk)
+		if err != nil {
+			return err
+		}
+		read += len(chunk)
+		inserted += len(chunkInserted)
+		chunk = chunk[:0]
+		return nil
+	}
+	for {
+		var n hashdb.Node
+		n, err = dr.Read()
+		if err != nil {
+			break
+		}
+		chunk = append(chunk, n)
+		if len(chunk) == importChunkSize {
+			if err = save(); err != nil {
+				break
+			}
+		}
+	}
+	if err == io.EOF {
+		err = save()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import failed, %v nodes saved: %v\n", read,
+			err)
+		return 1
+	}
+
+	log.Infof("Imported %v nodes, %v of them are new", read, inserted)
+	return 0
+}
+
+func parseRoots(args []string) ([]merkletree.Hash, error) {
+	roots := make([]merkletree.Hash, len(args))
+	for i := range args {
+		h, err := merkletree.NewHashFromHex(args[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid root hash %v: %v", args[i], err)
+		}
+		roots[i] = *h
+	}
+	return roots, nil
+}
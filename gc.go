@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/iden3/reverse-hash-service/hashdb"
+	"github.com/spf13/viper"
+)
+
+// gc deletes nodes not reachable from roots given in arguments or in a file,
+// from the last registered states of identities or from recently saved nodes
+func gc(v *viper.Viper, args []string) int {
+	fs := flag.NewFlagSet(cmdGC, flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false,
+		"report the number of nodes to delete without deleting them")
+	rootsFile := fs.String("roots", "",
+		"file with root hashes to retain, one per line")
+	keepStates := fs.Int("keep-states", 1,
+		"retain this many last registered states of every identity")
+	grace := fs.Duration("grace", 24*time.Hour,
+		"retain nodes saved within this period with their subtrees")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	rootArgs := fs.Args()
+	if *rootsFile != "" {
+		fileRoots, err := readRootsFile(*rootsFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		rootArgs = append(rootArgs, fileRoots...)
+	}
+	roots, err := parseRoots(rootArgs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	if v.GetString(cfgStorage) != storagePostgres {
+		fmt.Fprintf(os.Stderr, "gc is supported only for %v storage\n",
+			storagePostgres)
+		return 2
+	}
+	conn := setupPgPool(v)
+	defer conn.Close()
+
+	report, err := hashdb.GC(context.Background(), conn, roots, *keepStates,
+		*grace, *dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gc failed: %v\n", err)
+		return 1
+	}
+
+	printHashes("missing node", report.Missing)
+	fmt.Printf("retained states: %v, skipped states: %v, recent nodes: %v\n",
+		report.States, report.SkippedStates, report.Recent)
+	if report.DryRun {
+		fmt.Printf("reachable nodes: %v, nodes to delete: %v\n",
+			report.Reachable, report.Deleted)
+	} else {
+		fmt.Printf("reachable nodes: %v, deleted nodes: %v\n",
+			report.Reachable, report.Deleted)
+	}
+	return 0
+}
+
+// readRootsFile reads hashes from a file, one per line. Empty lines and lines
+// starting with # are skipped.
+func readRootsFile(fileName string) ([]string, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var roots []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		roots = append(roots, line)
+	}
+	return roots, s.Err()
+}
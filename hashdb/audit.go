@@ -0,0 +1,105 @@
+package hashdb
+
+import (
+	"context"
+	stderr "errors"
+
+	"github.com/iden3/go-merkletree-sql"
+)
+
+// AuditReport is the result of AuditTree.
+type AuditReport struct {
+	Root merkletree.Hash
+	// number of distinct nodes found in storage
+	Nodes int
+	// depth of the deepest node found, the root has depth 0
+	MaxDepth int
+	// referenced nodes not found in storage
+	Missing []merkletree.Hash
+	// nodes whose hash does not match their children
+	Invalid []merkletree.Hash
+	// nodes referenced by one of their descendants
+	Cycles []merkletree.Hash
+}
+
+// OK is true if no problems are found.
+func (r AuditReport) OK() bool {
+	return len(r.Missing) == 0 && len(r.Invalid) == 0 && len(r.Cycles) == 0
+}
+
+// AuditTree walks the tree from root and checks every node with IsValid.
+// Children of middle nodes and tree roots of identity state nodes are
+// followed. A node referenced several times is checked once. An error is
+// returned only if storage fails, problems of the tree are listed in the
+// report.
+func AuditTree(ctx context.Context, storage nodeGetter,
+	root merkletree.Hash) (AuditReport, error) {
+
+	a := auditor{
+		storage: storage,
+		report:  AuditReport{Root: root},
+		visited: make(map[merkletree.Hash]struct{}),
+		onPath:  make(map[merkletree.Hash]struct{}),
+	}
+	if root == merkletree.HashZero {
+		return a.report, nil
+	}
+	err := a.walk(ctx, root, 0)
+	return a.report, err
+}
+
+type auditor struct {
+	storage nodeGetter
+	report  AuditReport
+	visited map[merkletree.Hash]struct{}
+	// nodes from the root to the current one
+	onPath map[merkletree.Hash]struct{}
+}
+
+func (a *auditor) walk(ctx context.Context, hash merkletree.Hash,
+	depth int) error {
+
+	if _, ok := a.onPath[hash]; ok {
+		a.report.Cycles = append(a.report.Cycles, hash)
+		return nil
+	}
+	if _, ok := a.visited[hash]; ok {
+		return nil
+	}
+	a.visited[hash] = struct{}{}
+
+	n, err := a.storage.ByHash(ctx, hash)
+	if stderr.Is(err, ErrDoesNotExists) {
+		a.report.Missing = append(a.report.Missing, hash)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	a.report.Nodes++
+	if depth > a.report.MaxDepth {
+		a.report.MaxDepth = depth
+	}
+	valid, err := n.IsValid()
+	if err != nil || !valid {
+		a.report.Invalid = append(a.report.Invalid, hash)
+	}
+
+	var children []merkletree.Hash
+	switch n.Type() {
+	case NodeTypeMiddle, NodeTypeState:
+		children = n.Children
+	}
+
+	a.onPath[hash] = struct{}{}
+	defer delete(a.onPath, hash)
+	for _, c := range children {
+		if c == merkletree.HashZero {
+			continue
+		}
+		if err = a.walk(ctx, c, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package hashdb
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/go-merkletree-sql/db/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditTree(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 40)
+	require.NoError(t, err)
+	for _, k := range []int64{1, 3, 5, 7, 10} {
+		err = mt.Add(ctx, big.NewInt(k), big.NewInt(0))
+		require.NoError(t, err)
+	}
+	nodes := treeNodes(t, mt)
+	storage := nodesMap{}
+	for _, n := range nodes {
+		storage[n.Hash] = n
+	}
+
+	report, err := AuditTree(ctx, storage, *mt.Root())
+	require.NoError(t, err)
+	require.True(t, report.OK())
+	require.Equal(t, len(nodes), report.Nodes)
+	// keys 1 and 5 differ starting from the third bit
+	require.Equal(t, 3, report.MaxDepth)
+
+	// state node refers to the tree as claims and revocation tree roots
+	state := nodeOf(t, *mt.Root(), *mt.Root(), merkletree.HashZero)
+	storage[state.Hash] = state
+	report, err = AuditTree(ctx, storage, state.Hash)
+	require.NoError(t, err)
+	require.True(t, report.OK())
+	require.Equal(t, len(nodes)+1, report.Nodes)
+	require.Equal(t, 4, report.MaxDepth)
+
+	var leaves []Node
+	for _, n := range nodes {
+		if n.Type() == NodeTypeLeaf {
+			leaves = append(leaves, n)
+		}
+	}
+	// break one leaf and remove another one
+	broken := copyNode(leaves[0])
+	broken.Children[1] = hashOne
+	storage[broken.Hash] = broken
+	delete(storage, leaves[1].Hash)
+	report, err = AuditTree(ctx, storage, *mt.Root())
+	require.NoError(t, err)
+	require.False(t, report.OK())
+	require.Equal(t, []merkletree.Hash{leaves[1].Hash}, report.Missing)
+	require.Equal(t, []merkletree.Hash{leaves[0].Hash}, report.Invalid)
+	require.Empty(t, report.Cycles)
+
+	// nodes referencing each other
+	h1 := hashFromIntString(t, "1")
+	h2 := hashFromIntString(t, "2")
+	h3 := hashFromIntString(t, "3")
+	cycled := nodesMap{
+		h1: {Hash: h1, Children: []merkletree.Hash{h2, merkletree.HashZero}},
+		h2: {Hash: h2, Children: []merkletree.Hash{h3, h1}},
+	}
+	report, err = AuditTree(ctx, cycled, h1)
+	require.NoError(t, err)
+	require.Equal(t, AuditReport{
+		Root:     h1,
+		Nodes:    2,
+		MaxDepth: 1,
+		Missing:  []merkletree.Hash{h3},
+		Invalid:  []merkletree.Hash{h1, h2},
+		Cycles:   []merkletree.Hash{h1},
+	}, report)
+}
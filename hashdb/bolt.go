@@ -0,0 +1,239 @@
+package hashdb
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+)
+
+var bucketMtNode = []byte(tableMtNode)
+
+// bucketMtNodeMeta keeps when and by whom nodes were submitted first, see
+// boltNodeMeta
+var bucketMtNodeMeta = []byte("mt_node_meta")
+
+// boltStorage keeps nodes in an embedded bbolt database. Key is a node hash
+// and value is concatenated hashes of node children. Attribution of nodes is
+// kept in a separate bucket with the same keys, so the format of nodes does
+// not change.
+type boltStorage struct {
+	db *bbolt.DB
+}
+
+// boltNodeMeta is a JSON encoded value of bucketMtNodeMeta. Nodes saved
+// before the first submission time was recorded have no FirstSeen.
+type boltNodeMeta struct {
+	FirstSeen         *time.Time `json:"first_seen,omitempty"`
+	Submitter         string     `json:"submitter,omitempty"`
+	SubmitterIdentity string     `json:"submitter_identity,omitempty"`
+}
+
+// NewBolt creates storage on top of an opened bbolt database. Required
+// buckets are created if they do not exist.
+func NewBolt(db *bbolt.DB) (Storage, error) {
+	err := db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{bucketMtNode, bucketMtNodeMeta} {
+			_, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &boltStorage{db}, nil
+}
+
+// SaveNodes inserts nodes that are not stored yet in one transaction.
+// Inserted nodes are attributed to the submitter from ctx and the current
+// time. The submission is logged in the same transaction, see
+// WithSubmissionLog.
+func (b *boltStorage) SaveNodes(ctx context.Context,
+	nodes []Node) ([]merkletree.Hash, error) {
+
+	for i := range nodes {
+		if err := nodes[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	s := submitterFrom(ctx)
+	now := publishTime()
+	meta, err := json.Marshal(boltNodeMeta{&now, s.name, s.identity})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var inserted []merkletree.Hash
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(bucketMtNode)
+		metaBkt := tx.Bucket(bucketMtNodeMeta)
+		for i := range nodes {
+			if bkt.Get(nodes[i].Hash[:]) != nil {
+				continue
+			}
+			err := bkt.Put(nodes[i].Hash[:], encodeBoltChildren(nodes[i]))
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			err = metaBkt.Put(nodes[i].Hash[:], meta)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			inserted = append(inserted, nodes[i].Hash)
+		}
+
+		hook, ok := submissionHookFrom(ctx)
+		if !ok {
+			return nil
+		}
+		sub := hook.submission(ctx, len(nodes), inserted)
+		var err error
+		if l, ok := hook.log.(*boltSubmissionLog); ok && l.db == b.db {
+			_, err = putSubmission(tx, sub)
+		} else {
+			_, err = hook.log.LogSubmission(ctx, sub)
+		}
+		return errors.Wrap(err, "failed to log submission")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inserted, nil
+}
+
+func (b *boltStorage) ByHash(_ context.Context,
+	hash merkletree.Hash) (Node, error) {
+
+	var node = Node{Hash: hash}
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(bucketMtNode).Get(hash[:])
+		if v == nil {
+			return errors.WithStack(ErrDoesNotExists)
+		}
+		var err error
+		node.Children, err = decodeBoltChildren(v)
+		return err
+	})
+	return node, err
+}
+
+// ByHashWithMeta implements NodeMetaGetter.
+func (b *boltStorage) ByHashWithMeta(_ context.Context,
+	hash merkletree.Hash) (Node, error) {
+
+	var node = Node{Hash: hash, Meta: &NodeMeta{}}
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(bucketMtNode).Get(hash[:])
+		if v == nil {
+			return errors.WithStack(ErrDoesNotExists)
+		}
+		var err error
+		node.Children, err = decodeBoltChildren(v)
+		if err != nil {
+			return err
+		}
+
+		v = tx.Bucket(bucketMtNodeMeta).Get(hash[:])
+		if v == nil {
+			return nil
+		}
+		var meta boltNodeMeta
+		if err = json.Unmarshal(v, &meta); err != nil {
+			return errors.WithStack(err)
+		}
+		if meta.FirstSeen != nil {
+			node.Meta.FirstSeen = meta.FirstSeen.UTC()
+		}
+		node.Meta.Submitter = meta.Submitter
+		node.Meta.SubmitterIdentity = meta.SubmitterIdentity
+		return nil
+	})
+	return node, err
+}
+
+func (b *boltStorage) ByHashes(_ context.Context,
+	hashes []merkletree.Hash) ([]Node, error) {
+
+	var nodes []Node
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(bucketMtNode)
+		seen := make(map[merkletree.Hash]struct{}, len(hashes))
+		for _, h := range hashes {
+			if _, ok := seen[h]; ok {
+				continue
+			}
+			seen[h] = struct{}{}
+
+			v := bkt.Get(h[:])
+			if v == nil {
+				continue
+			}
+			children, err := decodeBoltChildren(v)
+			if err != nil {
+				return err
+			}
+			nodes = append(nodes, Node{Hash: h, Children: children})
+		}
+		return nil
+	})
+	return nodes, err
+}
+
+// ForEach iterates nodes in the order of hashes within one read-only
+// transaction.
+func (b *boltStorage) ForEach(_ context.Context, fn func(Node) error) error {
+	return b.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketMtNode).ForEach(func(k, v []byte) error {
+			var node Node
+			if len(k) != len(node.Hash) {
+				return errors.New(
+					"unexpected length of hash found in database")
+			}
+			copy(node.Hash[:], k)
+			var err error
+			node.Children, err = decodeBoltChildren(v)
+			if err != nil {
+				return err
+			}
+			return fn(node)
+		})
+	})
+}
+
+func (b *boltStorage) Ready(_ context.Context) error {
+	return b.db.View(func(tx *bbolt.Tx) error {
+		if tx.Bucket(bucketMtNode) == nil {
+			return errors.Errorf("bucket %s does not exist", bucketMtNode)
+		}
+		return nil
+	})
+}
+
+func encodeBoltChildren(n Node) []byte {
+	v := make([]byte, 0, len(n.Children)*len(merkletree.HashZero))
+	for i := range n.Children {
+		v = append(v, n.Children[i][:]...)
+	}
+	return v
+}
+
+// decodeBoltChildren copies children from value, as value is valid only
+// during transaction.
+func decodeBoltChildren(v []byte) ([]merkletree.Hash, error) {
+	if len(v)%len(merkletree.HashZero) != 0 {
+		return nil, errors.New(
+			"unexpected length of children found in database")
+	}
+	children := make([]merkletree.Hash, len(v)/len(merkletree.HashZero))
+	for i := range children {
+		copy(children[i][:], v[i*len(children[i]):])
+	}
+	return children, nil
+}
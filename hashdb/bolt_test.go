@@ -0,0 +1,115 @@
+package hashdb
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+)
+
+func newBoltDB(t testing.TB) *bbolt.DB {
+	db, err := bbolt.Open(filepath.Join(t.TempDir(), "rhs.db"), 0600, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, db.Close()) })
+	return db
+}
+
+func TestBoltStorage(t *testing.T) {
+	db := newBoltDB(t)
+	storage, err := NewBolt(db)
+	require.NoError(t, err)
+
+	n1 := makeNode(t,
+		"16938931282012536952003457515784019977456394464750325752202529629073057526316",
+		[]string{
+			"13668806873217811193138343672265398727158334092717678918544074543040898436197",
+			"6845643050256962634421298815823256099092239904213746305198440125223303121384",
+		},
+	)
+	n2 := makeNodeHex(t,
+		"658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e",
+		[]string{
+			"037c4d7bbb0407b8000000000000000000000000000000000000000000000000",
+			"0000000000000000000000000000000000000000000000000000000000000000",
+			"0100000000000000000000000000000000000000000000000000000000000000",
+		},
+	)
+
+	ctx := context.Background()
+	require.NoError(t, storage.Ready(ctx))
+
+	inserted, err := storage.SaveNodes(ctx, []Node{n1, n2})
+	require.NoError(t, err)
+	require.Equal(t, []merkletree.Hash{n1.Hash, n2.Hash}, inserted)
+	inserted, err = storage.SaveNodes(ctx, []Node{n2})
+	require.NoError(t, err)
+	require.Empty(t, inserted)
+
+	// reopen storage on the same database
+	storage, err = NewBolt(db)
+	require.NoError(t, err)
+
+	n3, err := storage.ByHash(ctx, n1.Hash)
+	require.NoError(t, err)
+	require.Equal(t, n1, n3)
+
+	n4, err := storage.ByHash(ctx, n2.Hash)
+	require.NoError(t, err)
+	require.Equal(t, n2, n4)
+
+	missingHash := hashFromIntString(t, "1")
+	_, err = storage.ByHash(ctx, missingHash)
+	require.EqualError(t, err, ErrDoesNotExists.Error())
+
+	nodes, err := storage.ByHashes(ctx,
+		[]merkletree.Hash{n1.Hash, missingHash, n2.Hash, n2.Hash})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []Node{n1, n2}, nodes)
+
+	require.ElementsMatch(t, []Node{n1, n2}, allNodes(t, storage))
+
+	badNode := makeNode(t, "1", []string{"1", "2"})
+	_, err = storage.SaveNodes(ctx, []Node{badNode})
+	require.EqualError(t, err, ErrIncorrectHash.Error())
+}
+
+func TestBoltStorage_Submitter(t *testing.T) {
+	db := newBoltDB(t)
+	storage, err := NewBolt(db)
+	require.NoError(t, err)
+
+	n1 := nodeOf(t, merkletree.Hash{1}, merkletree.Hash{2})
+	n2 := nodeOf(t, merkletree.Hash{3}, merkletree.Hash{4})
+	ctx := context.Background()
+	_, err = storage.SaveNodes(WithSubmitterIdentity(
+		WithSubmitter(ctx, "alice"), "did:iden3:x1"), []Node{n1})
+	require.NoError(t, err)
+	// the first submitter is kept
+	_, err = storage.SaveNodes(WithSubmitter(ctx, "bob"), []Node{n1, n2})
+	require.NoError(t, err)
+
+	metas := make(map[merkletree.Hash]boltNodeMeta)
+	err = db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketMtNodeMeta).ForEach(func(k, v []byte) error {
+			var h merkletree.Hash
+			copy(h[:], k)
+			var meta boltNodeMeta
+			if err := json.Unmarshal(v, &meta); err != nil {
+				return err
+			}
+			require.NotNil(t, meta.FirstSeen)
+			meta.FirstSeen = nil
+			metas[h] = meta
+			return nil
+		})
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[merkletree.Hash]boltNodeMeta{
+		n1.Hash: {Submitter: "alice", SubmitterIdentity: "did:iden3:x1"},
+		n2.Hash: {Submitter: "bob"},
+	}, metas)
+}
@@ -0,0 +1,220 @@
+package hashdb
+
+import (
+	"container/list"
+	"context"
+	stderr "errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/pkg/errors"
+)
+
+// CachedStorage is a read-through cache in front of Storage. Nodes are
+// immutable, so found nodes are kept until evicted by newer ones. Not found
+// nodes are cached for a short time only, as they may be submitted later.
+type CachedStorage struct {
+	Storage
+
+	size        int
+	negativeTTL time.Duration
+
+	mu    sync.Mutex
+	lru   *list.List
+	items map[merkletree.Hash]*list.Element
+
+	hits   uint64
+	misses uint64
+}
+
+type cacheEntry struct {
+	node Node
+	// if not zero, the node does not exist in storage and the entry is
+	// valid until this moment
+	notFoundUntil time.Time
+}
+
+// CacheStats are cache counters since the cache creation
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+	// current number of cached entries
+	Len int
+}
+
+// NewCache wraps storage with an LRU cache of at most size entries. If
+// negativeTTL is zero, not found nodes are not cached.
+func NewCache(storage Storage, size int,
+	negativeTTL time.Duration) *CachedStorage {
+
+	return &CachedStorage{
+		Storage:     storage,
+		size:        size,
+		negativeTTL: negativeTTL,
+		lru:         list.New(),
+		items:       make(map[merkletree.Hash]*list.Element),
+	}
+}
+
+func (c *CachedStorage) SaveNodes(ctx context.Context,
+	nodes []Node) ([]merkletree.Hash, error) {
+
+	inserted, err := c.Storage.SaveNodes(ctx, nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	// forget that saved nodes were not found before
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range nodes {
+		e, ok := c.items[nodes[i].Hash]
+		if ok && !e.Value.(*cacheEntry).notFoundUntil.IsZero() {
+			c.remove(e)
+		}
+	}
+	return inserted, nil
+}
+
+func (c *CachedStorage) ByHash(ctx context.Context,
+	hash merkletree.Hash) (Node, error) {
+
+	node, found, ok := c.get(hash)
+	if ok {
+		atomic.AddUint64(&c.hits, 1)
+		if !found {
+			return node, errors.WithStack(ErrDoesNotExists)
+		}
+		return node, nil
+	}
+	atomic.AddUint64(&c.misses, 1)
+
+	node, err := c.Storage.ByHash(ctx, hash)
+	switch {
+	case err == nil:
+		c.add(hash, &cacheEntry{node: copyNode(node)})
+	case stderr.Is(err, ErrDoesNotExists):
+		c.addNotFound(hash)
+	}
+	return node, err
+}
+
+func (c *CachedStorage) ByHashes(ctx context.Context,
+	hashes []merkletree.Hash) ([]Node, error) {
+
+	var nodes []Node
+	var missed []merkletree.Hash
+	seen := make(map[merkletree.Hash]struct{}, len(hashes))
+	for _, h := range hashes {
+		if _, ok := seen[h]; ok {
+			continue
+		}
+		seen[h] = struct{}{}
+
+		node, found, ok := c.get(h)
+		switch {
+		case !ok:
+			missed = append(missed, h)
+		case found:
+			nodes = append(nodes, node)
+		}
+	}
+	atomic.AddUint64(&c.hits, uint64(len(seen)-len(missed)))
+	atomic.AddUint64(&c.misses, uint64(len(missed)))
+
+	if len(missed) == 0 {
+		return nodes, nil
+	}
+
+	missedNodes, err := c.Storage.ByHashes(ctx, missed)
+	if err != nil {
+		return nil, err
+	}
+	foundHashes := make(map[merkletree.Hash]struct{}, len(missedNodes))
+	for i := range missedNodes {
+		foundHashes[missedNodes[i].Hash] = struct{}{}
+		c.add(missedNodes[i].Hash, &cacheEntry{node: copyNode(missedNodes[i])})
+	}
+	for _, h := range missed {
+		if _, ok := foundHashes[h]; !ok {
+			c.addNotFound(h)
+		}
+	}
+
+	return append(nodes, missedNodes...), nil
+}
+
+// Stats returns cache counters
+func (c *CachedStorage) Stats() CacheStats {
+	c.mu.Lock()
+	l := c.lru.Len()
+	c.mu.Unlock()
+	return CacheStats{
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+		Len:    l,
+	}
+}
+
+// get returns the node from cache. If ok is false, the entry is not cached.
+// If found is false, the node is known to be missing from storage.
+func (c *CachedStorage) get(hash merkletree.Hash) (node Node, found,
+	ok bool) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[hash]
+	if !ok {
+		return Node{Hash: hash}, false, false
+	}
+	entry := e.Value.(*cacheEntry)
+	if !entry.notFoundUntil.IsZero() {
+		if time.Now().After(entry.notFoundUntil) {
+			c.remove(e)
+			return Node{Hash: hash}, false, false
+		}
+		c.lru.MoveToFront(e)
+		return Node{Hash: hash}, false, true
+	}
+	c.lru.MoveToFront(e)
+	return copyNode(entry.node), true, true
+}
+
+func (c *CachedStorage) addNotFound(hash merkletree.Hash) {
+	if c.negativeTTL <= 0 {
+		return
+	}
+	c.add(hash, &cacheEntry{
+		node:          Node{Hash: hash},
+		notFoundUntil: time.Now().Add(c.negativeTTL),
+	})
+}
+
+func (c *CachedStorage) add(hash merkletree.Hash, entry *cacheEntry) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[hash]; ok {
+		e.Value = entry
+		c.lru.MoveToFront(e)
+		return
+	}
+
+	c.items[hash] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove must be called with c.mu locked
+func (c *CachedStorage) remove(e *list.Element) {
+	c.lru.Remove(e)
+	delete(c.items, e.Value.(*cacheEntry).node.Hash)
+}
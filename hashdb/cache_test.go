@@ -0,0 +1,104 @@
+package hashdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStorage counts requests to the underlying storage
+type countingStorage struct {
+	Storage
+	byHash int
+}
+
+func (s *countingStorage) ByHash(ctx context.Context,
+	hash merkletree.Hash) (Node, error) {
+
+	s.byHash++
+	return s.Storage.ByHash(ctx, hash)
+}
+
+func TestCachedStorage(t *testing.T) {
+	ctx := context.Background()
+	backend := &countingStorage{Storage: NewMemory()}
+	storage := NewCache(backend, 2, time.Hour)
+
+	n1 := makeNode(t,
+		"16938931282012536952003457515784019977456394464750325752202529629073057526316",
+		[]string{
+			"13668806873217811193138343672265398727158334092717678918544074543040898436197",
+			"6845643050256962634421298815823256099092239904213746305198440125223303121384",
+		},
+	)
+	n2 := makeNodeHex(t,
+		"658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e",
+		[]string{
+			"037c4d7bbb0407b8000000000000000000000000000000000000000000000000",
+			"0000000000000000000000000000000000000000000000000000000000000000",
+			"0100000000000000000000000000000000000000000000000000000000000000",
+		},
+	)
+	_, err := storage.SaveNodes(ctx, []Node{n1})
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		n, err := storage.ByHash(ctx, n1.Hash)
+		require.NoError(t, err)
+		require.Equal(t, n1, n)
+	}
+	require.Equal(t, 1, backend.byHash)
+	require.Equal(t, CacheStats{Hits: 2, Misses: 1, Len: 1}, storage.Stats())
+
+	// not found node is cached too
+	for i := 0; i < 2; i++ {
+		_, err = storage.ByHash(ctx, n2.Hash)
+		require.ErrorIs(t, err, ErrDoesNotExists)
+	}
+	require.Equal(t, 2, backend.byHash)
+
+	// saving node drops negative cache entry
+	_, err = storage.SaveNodes(ctx, []Node{n2})
+	require.NoError(t, err)
+	n, err := storage.ByHash(ctx, n2.Hash)
+	require.NoError(t, err)
+	require.Equal(t, n2, n)
+	require.Equal(t, 3, backend.byHash)
+
+	// the least recently used node n1 is evicted
+	_, err = storage.ByHash(ctx, hashFromIntString(t, "1"))
+	require.ErrorIs(t, err, ErrDoesNotExists)
+	_, err = storage.ByHash(ctx, n1.Hash)
+	require.NoError(t, err)
+	require.Equal(t, 5, backend.byHash)
+	require.Equal(t, 2, storage.Stats().Len)
+
+	nodes, err := storage.ByHashes(ctx,
+		[]merkletree.Hash{n1.Hash, n2.Hash, hashFromIntString(t, "2")})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []Node{n1, n2}, nodes)
+}
+
+func TestCachedStorage_NegativeTTL(t *testing.T) {
+	ctx := context.Background()
+	backend := &countingStorage{Storage: NewMemory()}
+	storage := NewCache(backend, 10, time.Millisecond)
+
+	missingHash := hashFromIntString(t, "1")
+	_, err := storage.ByHash(ctx, missingHash)
+	require.ErrorIs(t, err, ErrDoesNotExists)
+	time.Sleep(2 * time.Millisecond)
+	_, err = storage.ByHash(ctx, missingHash)
+	require.ErrorIs(t, err, ErrDoesNotExists)
+	require.Equal(t, 2, backend.byHash)
+
+	storage = NewCache(backend, 10, 0)
+	for i := 0; i < 2; i++ {
+		_, err = storage.ByHash(ctx, missingHash)
+		require.ErrorIs(t, err, ErrDoesNotExists)
+	}
+	require.Equal(t, 4, backend.byHash)
+}
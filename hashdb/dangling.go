@@ -0,0 +1,63 @@
+package hashdb
+
+import (
+	"context"
+
+	"github.com/iden3/go-merkletree-sql"
+)
+
+type nodesBatchGetter interface {
+	ByHashes(ctx context.Context, hashes []merkletree.Hash) ([]Node, error)
+}
+
+// DanglingChildren returns non-zero children of middle nodes that are found
+// neither in nodes nor in storage. Hashes are returned in the order they
+// appear in nodes, without duplicates.
+func DanglingChildren(ctx context.Context, storage nodesBatchGetter,
+	nodes []Node) ([]merkletree.Hash, error) {
+
+	known := make(map[merkletree.Hash]struct{}, len(nodes))
+	for i := range nodes {
+		known[nodes[i].Hash] = struct{}{}
+	}
+
+	var refs []merkletree.Hash
+	seen := make(map[merkletree.Hash]struct{})
+	for i := range nodes {
+		if nodes[i].Type() != NodeTypeMiddle {
+			continue
+		}
+		for _, c := range nodes[i].Children {
+			if c == merkletree.HashZero {
+				continue
+			}
+			if _, ok := known[c]; ok {
+				continue
+			}
+			if _, ok := seen[c]; ok {
+				continue
+			}
+			seen[c] = struct{}{}
+			refs = append(refs, c)
+		}
+	}
+	if len(refs) == 0 {
+		return nil, nil
+	}
+
+	found, err := storage.ByHashes(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range found {
+		known[found[i].Hash] = struct{}{}
+	}
+
+	var dangling []merkletree.Hash
+	for _, h := range refs {
+		if _, ok := known[h]; !ok {
+			dangling = append(dangling, h)
+		}
+	}
+	return dangling, nil
+}
@@ -0,0 +1,38 @@
+package hashdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDanglingChildren(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemory()
+
+	h1 := hashFromIntString(t, "1")
+	h2 := hashFromIntString(t, "2")
+	leaf1 := nodeOf(t, h1, h2, h1)
+	leaf2 := nodeOf(t, h2, h2, h1)
+	leaf3 := nodeOf(t, h1, h1, h1)
+	_, err := storage.SaveNodes(ctx, []Node{leaf1})
+	require.NoError(t, err)
+
+	// leaf1 is in storage, leaf2 is in the batch, leaf3 is missing
+	mid1 := nodeOf(t, leaf1.Hash, leaf2.Hash)
+	mid2 := nodeOf(t, leaf3.Hash, merkletree.HashZero)
+	mid3 := nodeOf(t, mid1.Hash, leaf3.Hash)
+	// children of leaves and states are not references to nodes
+	state := nodeOf(t, h1, h2, merkletree.HashZero)
+
+	dangling, err := DanglingChildren(ctx, storage,
+		[]Node{mid1, mid2, mid3, leaf2, state})
+	require.NoError(t, err)
+	require.Equal(t, []merkletree.Hash{leaf3.Hash}, dangling)
+
+	dangling, err = DanglingChildren(ctx, storage, []Node{mid1, leaf2})
+	require.NoError(t, err)
+	require.Empty(t, dangling)
+}
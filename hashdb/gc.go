@@ -0,0 +1,168 @@
+package hashdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+)
+
+// gcLockID is an advisory lock held exclusively by GC and shared by
+// SaveNodes, so nodes are not saved while GC runs.
+const gcLockID = 5_190_338_217
+
+// temporary table of hashes of reachable nodes
+const tableGCKeep = "mt_node_gc_keep"
+
+// GCReport is a result of GC.
+type GCReport struct {
+	// number of nodes reachable from retained roots, registered identity
+	// states and recently saved nodes
+	Reachable int
+	// number of registered identity states that were retained and that
+	// were too old to be retained
+	States        int
+	SkippedStates int
+	// number of nodes saved within the grace period
+	Recent int
+	// nodes referenced from reachable nodes but not found in storage
+	Missing []merkletree.Hash
+	// number of deleted nodes, or nodes that would be deleted on dry run
+	Deleted int64
+	DryRun  bool
+}
+
+// GC deletes from PostgreSQL storage all nodes not reachable from roots.
+// Roots may be tree roots or identity states, for states all three trees are
+// retained. Every root must exist in storage, otherwise nothing is deleted.
+//
+// The last keepStates states of every identity registered in the
+// identity_state table are retained too, so roots may be empty if there are
+// registered states. Older states are not retained unless given in roots.
+//
+// Nodes saved within grace before GC started are retained with their
+// subtrees, because trees are submitted in many requests and the root of a
+// tree being submitted is not known yet. Nodes saved before first_seen_at
+// was recorded are not considered recent.
+//
+// GC holds a lock that blocks SaveNodes until it finishes, so a node saved
+// concurrently can't reference a deleted node. On dry run nothing is deleted,
+// SaveNodes is not blocked and the report tells how many nodes would be
+// deleted.
+func GC(ctx context.Context, db dbI, roots []merkletree.Hash, keepStates int,
+	grace time.Duration, dryRun bool) (GCReport, error) {
+
+	report := GCReport{DryRun: dryRun}
+	err := db.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if !dryRun {
+			_, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`,
+				gcLockID)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		states, err := queryHashes(ctx, tx, fmt.Sprintf(`
+SELECT state FROM (
+    SELECT state,
+           row_number() OVER (PARTITION BY identity ORDER BY id DESC) AS n
+    FROM %v) s
+WHERE n <= $1`, quote(tableIdentityState)), keepStates)
+		if err != nil {
+			return err
+		}
+		if len(roots) == 0 && len(states) == 0 {
+			return errors.New("no roots to retain")
+		}
+		var registered int
+		err = tx.QueryRow(ctx, fmt.Sprintf(`SELECT count(*) FROM %v`,
+			quote(tableIdentityState))).Scan(&registered)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		report.States = len(states)
+		report.SkippedStates = registered - len(states)
+
+		var recent []merkletree.Hash
+		if grace > 0 {
+			recent, err = queryHashes(ctx, tx, fmt.Sprintf(`
+SELECT hash FROM %v
+WHERE first_seen_at >= now() - make_interval(secs => $1)`,
+				quote(tableMtNode)), grace.Seconds())
+			if err != nil {
+				return err
+			}
+		}
+		report.Recent = len(recent)
+
+		report.Reachable, report.Missing, err = markNodes(ctx, tx, roots,
+			append(states, recent...))
+		if err != nil {
+			return err
+		}
+
+		if dryRun {
+			err = tx.QueryRow(ctx, fmt.Sprintf(`
+SELECT count(*) FROM %[1]v n
+WHERE NOT EXISTS (SELECT 1 FROM %[2]v k WHERE k.hash = n.hash)`,
+				quote(tableMtNode), quote(tableGCKeep))).
+				Scan(&report.Deleted)
+			return errors.WithStack(err)
+		}
+
+		tag, err := tx.Exec(ctx, fmt.Sprintf(`
+DELETE FROM %[1]v n
+WHERE NOT EXISTS (SELECT 1 FROM %[2]v k WHERE k.hash = n.hash)`,
+			quote(tableMtNode), quote(tableGCKeep)))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		report.Deleted = tag.RowsAffected()
+		return nil
+	})
+	return report, err
+}
+
+// markNodes walks trees from roots and extraRoots and loads hashes of all
+// found nodes into a temporary table dropped on transaction end. Unlike
+// extraRoots, every root must exist.
+func markNodes(ctx context.Context, tx pgx.Tx, roots,
+	extraRoots []merkletree.Hash) (int, []merkletree.Hash, error) {
+
+	var rows [][]interface{}
+	missing, err := WalkTrees(ctx, &pgStorage{tx},
+		append(roots[:len(roots):len(roots)], extraRoots...),
+		func(n Node) error {
+			rows = append(rows, []interface{}{n.Hash[:]})
+			return nil
+		})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	missingSet := make(map[merkletree.Hash]struct{}, len(missing))
+	for _, h := range missing {
+		missingSet[h] = struct{}{}
+	}
+	for _, r := range roots {
+		if _, ok := missingSet[r]; ok {
+			return 0, nil, errors.Errorf("root %v not found", r.Hex())
+		}
+	}
+
+	_, err = tx.Exec(ctx, fmt.Sprintf(`
+CREATE TEMPORARY TABLE %v (hash BYTEA PRIMARY KEY) ON COMMIT DROP`,
+		quote(tableGCKeep)))
+	if err != nil {
+		return 0, nil, errors.WithStack(err)
+	}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{tableGCKeep},
+		[]string{"hash"}, pgx.CopyFromRows(rows))
+	if err != nil {
+		return 0, nil, errors.WithStack(err)
+	}
+	return len(rows), missing, nil
+}
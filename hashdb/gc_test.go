@@ -0,0 +1,138 @@
+package hashdb
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/go-merkletree-sql/db/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGC(t *testing.T) {
+	db := dbtest.WithEmpty(t)
+	storage := New(db)
+	ctx := context.Background()
+
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 40)
+	require.NoError(t, err)
+	for _, k := range []int64{1, 3, 5, 7} {
+		require.NoError(t, mt.Add(ctx, big.NewInt(k), big.NewInt(0)))
+	}
+	oldNodes := treeNodes(t, mt)
+	oldRoot := *mt.Root()
+	_, err = storage.SaveNodes(ctx, oldNodes)
+	require.NoError(t, err)
+
+	_, err = mt.Update(ctx, big.NewInt(7), big.NewInt(1))
+	require.NoError(t, err)
+	newNodes := treeNodes(t, mt)
+	state := nodeOf(t, *mt.Root(), merkletree.HashZero,
+		merkletree.HashZero)
+	_, err = storage.SaveNodes(ctx, append(newNodes, state))
+	require.NoError(t, err)
+
+	// nodes of the old tree that are not shared with the new one
+	newSet := make(map[merkletree.Hash]struct{})
+	for _, n := range newNodes {
+		newSet[n.Hash] = struct{}{}
+	}
+	var garbage int64
+	for _, n := range oldNodes {
+		if _, ok := newSet[n.Hash]; !ok {
+			garbage++
+		}
+	}
+	require.NotZero(t, garbage)
+	all := allNodes(t, storage)
+
+	_, err = GC(ctx, db, []merkletree.Hash{merkletree.Hash{1}}, 0, 0,
+		false)
+	require.EqualError(t, err, "root "+merkletree.Hash{1}.Hex()+
+		" not found")
+	_, err = GC(ctx, db, nil, 0, 0, false)
+	require.EqualError(t, err, "no roots to retain")
+
+	report, err := GC(ctx, db, []merkletree.Hash{state.Hash}, 0, 0,
+		true)
+	require.NoError(t, err)
+	require.Equal(t, GCReport{Reachable: len(newNodes) + 1, Deleted: garbage,
+		DryRun: true}, report)
+	require.Len(t, allNodes(t, storage), len(all))
+
+	// all nodes are saved within the grace period
+	report, err = GC(ctx, db, []merkletree.Hash{state.Hash}, 0,
+		time.Hour, false)
+	require.NoError(t, err)
+	require.Equal(t, GCReport{Reachable: len(all), Recent: len(all)},
+		report)
+	require.Len(t, allNodes(t, storage), len(all))
+
+	report, err = GC(ctx, db, []merkletree.Hash{state.Hash}, 0, 0,
+		false)
+	require.NoError(t, err)
+	require.Equal(t, GCReport{Reachable: len(newNodes) + 1, Deleted: garbage},
+		report)
+	require.ElementsMatch(t, append(newNodes, state),
+		allNodes(t, storage))
+	_, err = storage.ByHash(ctx, oldRoot)
+	require.ErrorIs(t, err, ErrDoesNotExists)
+}
+
+func TestGC_BlocksSaveNodes(t *testing.T) {
+	db := dbtest.WithEmpty(t)
+	storage := New(db)
+	ctx := context.Background()
+
+	tx, err := db.Begin(ctx)
+	require.NoError(t, err)
+	defer func() { _ = tx.Rollback(ctx) }()
+	_, err = tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, gcLockID)
+	require.NoError(t, err)
+
+	n := nodeOf(t, merkletree.Hash{1}, merkletree.Hash{2})
+	ctx2, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	_, err = storage.SaveNodes(ctx2, []Node{n})
+	require.Error(t, err)
+
+	require.NoError(t, tx.Rollback(ctx))
+	_, err = storage.SaveNodes(ctx, []Node{n})
+	require.NoError(t, err)
+}
+
+func TestGC_RegisteredStates(t *testing.T) {
+	db := dbtest.WithEmpty(t)
+	storage := New(db)
+	states := NewStateRegistry(db)
+	ctx := context.Background()
+
+	n1 := nodeOf(t, merkletree.Hash{1}, merkletree.Hash{2})
+	n2 := nodeOf(t, merkletree.Hash{3}, merkletree.Hash{4})
+	state1 := nodeOf(t, n1.Hash, merkletree.HashZero, merkletree.HashZero)
+	state2 := nodeOf(t, n2.Hash, merkletree.HashZero, merkletree.HashZero)
+	_, err := storage.SaveNodes(ctx, []Node{n1, n2, state1, state2})
+	require.NoError(t, err)
+	for _, s := range []Node{state1, state2} {
+		_, err = states.PublishState(ctx, "identity", s.Hash)
+		require.NoError(t, err)
+	}
+
+	_, err = GC(ctx, db, nil, 0, 0, false)
+	require.EqualError(t, err, "no roots to retain")
+
+	// the last state is retained without roots given
+	report, err := GC(ctx, db, nil, 1, 0, false)
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Reachable)
+	require.Equal(t, 1, report.States)
+	require.Equal(t, 1, report.SkippedStates)
+	require.Equal(t, int64(2), report.Deleted)
+	// children of n2 are not saved
+	require.ElementsMatch(t,
+		[]merkletree.Hash{merkletree.Hash{3}, merkletree.Hash{4}},
+		report.Missing)
+	require.ElementsMatch(t, []Node{n2, state2}, allNodes(t, storage))
+}
@@ -22,11 +22,56 @@ var ErrIncorrectHash = stderr.New("node hash is not correct")
 const (
 	keyHash     = "hash"
 	keyChildren = "children"
+	keyType     = "type"
+	keyMeta     = "meta"
 )
 
 type Node struct {
 	Hash     merkletree.Hash
 	Children []merkletree.Hash
+	// optional metadata, set only by NodeMetaGetter
+	Meta *NodeMeta
+}
+
+// NodeType is a kind of node guessed by the shape of its children.
+type NodeType byte
+
+const (
+	NodeTypeUnknown NodeType = iota
+	NodeTypeMiddle
+	NodeTypeLeaf
+	NodeTypeState
+)
+
+func (t NodeType) String() string {
+	switch t {
+	case NodeTypeMiddle:
+		return "middle"
+	case NodeTypeLeaf:
+		return "leaf"
+	case NodeTypeState:
+		return "state"
+	default:
+		return "unknown"
+	}
+}
+
+var hashOne = *merkletree.NewHashFromBigInt(big.NewInt(1))
+
+// Type returns the type of node. Middle nodes have two children, leaves have
+// three children with the last one equal to 1 and state nodes have three
+// children: claims tree root, revocation tree root and roots tree root.
+func (n Node) Type() NodeType {
+	switch {
+	case len(n.Children) == 2:
+		return NodeTypeMiddle
+	case len(n.Children) == 3 && n.Children[2] == hashOne:
+		return NodeTypeLeaf
+	case len(n.Children) == 3:
+		return NodeTypeState
+	default:
+		return NodeTypeUnknown
+	}
 }
 
 func (n Node) MarshalJSON() ([]byte, error) {
@@ -37,6 +82,10 @@ func (n Node) MarshalJSON() ([]byte, error) {
 		children[i] = hex.EncodeToString(n.Children[i][:])
 	}
 	obj[keyChildren] = children
+	obj[keyType] = n.Type().String()
+	if n.Meta != nil {
+		obj[keyMeta] = n.Meta
+	}
 	bytes, err := json.Marshal(obj)
 	return bytes, errors.WithStack(err)
 }
@@ -92,6 +141,19 @@ func (n *Node) UnmarshalJSON(bytes []byte) error {
 	}
 	delete(obj, keyChildren)
 
+	// type is optional, but if present must match the children
+	if typeI, ok := obj[keyType]; ok {
+		typeS, ok := typeI.(string)
+		if !ok {
+			return errors.Errorf("'%v' value is not a string", keyType)
+		}
+		if nt := n.Type(); typeS != nt.String() {
+			return errors.Errorf("'%v' value does not match children: "+
+				"expected %v, got %v", keyType, nt, typeS)
+		}
+		delete(obj, keyType)
+	}
+
 	for k := range obj {
 		return errors.Errorf("unexpected key: %v", k)
 	}
@@ -128,12 +190,25 @@ func (n Node) hashChildren() (merkletree.Hash, error) {
 }
 
 type Storage interface {
-	SaveNodes(ctx context.Context, nodes []Node) error
+	// SaveNodes validates and saves nodes. Returns hashes of nodes that were
+	// not stored before.
+	SaveNodes(ctx context.Context, nodes []Node) ([]merkletree.Hash, error)
 	ByHash(ctx context.Context, hash merkletree.Hash) (Node, error)
+	// ByHashes returns nodes found by hashes. Missing nodes are skipped, so
+	// the result may be shorter than the list of hashes. The order of
+	// nodes is not defined.
+	ByHashes(ctx context.Context, hashes []merkletree.Hash) ([]Node, error)
+	// ForEach calls fn for every stored node. Iteration stops on the first
+	// error returned by fn, and the error is returned.
+	ForEach(ctx context.Context, fn func(Node) error) error
+	// Ready returns an error if storage can't serve requests
+	Ready(ctx context.Context) error
 }
 
 const (
 	tableMtNode = "mt_node"
+	// temporary table for loading nodes with COPY
+	tableMtNodeCopy = "mt_node_copy"
 )
 
 type dbI interface {
@@ -151,50 +226,160 @@ type pgStorage struct {
 
 const insertNodeChunkSize = 1000
 
-// SaveNodes inserts leaf and middle nodes into database.
-func (p *pgStorage) SaveNodes(ctx context.Context, nodes []Node) error {
-	return p.db.BeginFunc(ctx, func(tx pgx.Tx) error {
-		for i := 0; i < len(nodes); i += insertNodeChunkSize {
-			maxIdx := i + insertNodeChunkSize
-			if maxIdx > len(nodes) {
-				maxIdx = len(nodes)
-			}
-			nodesChunk := nodes[i:maxIdx]
-			sqlQuery, sqlParams, err := mkInsertNodesSQL(nodesChunk)
-			if err != nil {
-				return err
-			}
-			_, err = tx.Exec(ctx, sqlQuery, sqlParams...)
-			if err != nil {
-				return errors.WithStack(err)
-			}
+// starting from this number of nodes SaveNodes loads them with COPY instead
+// of multi-row INSERTs
+const copyNodesThreshold = 10 * insertNodeChunkSize
+
+// SaveNodes inserts leaf and middle nodes into database. The submission is
+// logged in the same transaction, see WithSubmissionLog.
+func (p *pgStorage) SaveNodes(ctx context.Context,
+	nodes []Node) ([]merkletree.Hash, error) {
+
+	var inserted []merkletree.Hash
+	err := p.db.BeginFunc(ctx, func(tx pgx.Tx) error {
+		// wait for running GC, see GC
+		_, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock_shared($1)`,
+			gcLockID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		submitter := submitterFrom(ctx)
+		if len(nodes) >= copyNodesThreshold {
+			inserted, err = copyNodes(ctx, tx, nodes, submitter)
+		} else {
+			inserted, err = insertNodes(ctx, tx, nodes, submitter)
+		}
+		if err != nil {
+			return err
+		}
+
+		hook, ok := submissionHookFrom(ctx)
+		if !ok {
+			return nil
+		}
+		sub := hook.submission(ctx, len(nodes), inserted)
+		if l, ok := hook.log.(*pgSubmissionLog); ok && l.db == p.db {
+			_, err = insertSubmission(ctx, tx, sub)
+		} else {
+			_, err = hook.log.LogSubmission(ctx, sub)
 		}
-		return nil
+		return errors.Wrap(err, "failed to log submission")
 	})
+	if err != nil {
+		return nil, err
+	}
+	return inserted, nil
+}
+
+// insertNodes saves nodes with INSERT statements of insertNodeChunkSize rows
+// each.
+func insertNodes(ctx context.Context, tx pgx.Tx, nodes []Node,
+	submitter submitter) ([]merkletree.Hash, error) {
+
+	var inserted []merkletree.Hash
+	for i := 0; i < len(nodes); i += insertNodeChunkSize {
+		maxIdx := i + insertNodeChunkSize
+		if maxIdx > len(nodes) {
+			maxIdx = len(nodes)
+		}
+		nodesChunk := nodes[i:maxIdx]
+		sqlQuery, sqlParams, err := mkInsertNodesSQL(nodesChunk, submitter)
+		if err != nil {
+			return nil, err
+		}
+		chunkInserted, err := queryHashes(ctx, tx, sqlQuery, sqlParams...)
+		if err != nil {
+			return nil, err
+		}
+		inserted = append(inserted, chunkInserted...)
+	}
+	return inserted, nil
 }
 
-func mkInsertNodesSQL(
-	nodes []Node) (query string, params []interface{}, err error) {
+// copyNodes loads nodes into a temporary table with COPY and then moves new
+// ones to mt_node with a single INSERT. The temporary table is dropped on
+// transaction end.
+func copyNodes(ctx context.Context, tx pgx.Tx, nodes []Node,
+	submitter submitter) ([]merkletree.Hash, error) {
+
+	rows := make([][]interface{}, len(nodes))
+	for i := range nodes {
+		if err := nodes[i].Validate(); err != nil {
+			return nil, err
+		}
+
+		children := make([][]byte, len(nodes[i].Children))
+		for j := range nodes[i].Children {
+			children[j] = nodes[i].Children[j][:]
+		}
+		var pgChildren pgtype.ByteaArray
+		if err := pgChildren.Set(children); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		rows[i] = []interface{}{nodes[i].Hash[:], pgChildren,
+			int16(nodes[i].Type())}
+	}
+
+	_, err := tx.Exec(ctx, fmt.Sprintf(`
+CREATE TEMPORARY TABLE %v (hash BYTEA, children BYTEA[], type SMALLINT)
+ON COMMIT DROP`, quote(tableMtNodeCopy)))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{tableMtNodeCopy},
+		[]string{"hash", "children", "type"}, pgx.CopyFromRows(rows))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return queryHashes(ctx, tx, fmt.Sprintf(`
+INSERT INTO %[1]v (hash, children, type, submitter, submitter_identity)
+SELECT hash, children, type, $1, $2 FROM %[2]v
+ON CONFLICT DO NOTHING
+RETURNING hash`, quote(tableMtNode), quote(tableMtNodeCopy)),
+		pgText(submitter.name), pgText(submitter.identity))
+}
+
+// queryHashes runs a query that returns one column of hashes
+func queryHashes(ctx context.Context, db dbI, query string,
+	args ...interface{}) ([]merkletree.Hash, error) {
+
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var hashes []merkletree.Hash
+	for rows.Next() {
+		var hashB []byte
+		if err = rows.Scan(&hashB); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		var h merkletree.Hash
+		if len(hashB) != len(h) {
+			return nil, errors.New(
+				"unexpected length of hash found in database")
+		}
+		copy(h[:], hashB)
+		hashes = append(hashes, h)
+	}
+	return hashes, errors.WithStack(rows.Err())
+}
+
+func mkInsertNodesSQL(nodes []Node,
+	submitter submitter) (query string, params []interface{}, err error) {
 
 	type sqlNode struct {
 		hash     pgtype.Bytea
 		children pgtype.ByteaArray
+		nodeType int16
 	}
 	var sqlNodes = make([]sqlNode, len(nodes))
-	var valid bool
 
 	for i := range nodes {
-		valid, err = nodes[i].IsValid()
-		if err != nil {
-			return
-		}
-		if !valid {
-			err = errors.WithStack(ErrIncorrectHash)
-			return
-		}
-
-		if nodes[i].Hash == merkletree.HashZero {
-			err = errors.New("node hash zero hash")
+		if err = nodes[i].Validate(); err != nil {
 			return
 		}
 
@@ -214,25 +399,54 @@ func mkInsertNodesSQL(
 			err = errors.WithStack(err)
 			return
 		}
+		sqlNodes[i].nodeType = int16(nodes[i].Type())
 	}
 
+	name, identity := pgText(submitter.name), pgText(submitter.identity)
 	var valuesStrs []string
 	for i := range sqlNodes {
-		valuesStrs = append(valuesStrs,
-			fmt.Sprintf("($%v,$%v)", i*2+1, i*2+2))
-		params = append(params, sqlNodes[i].hash, sqlNodes[i].children)
+		valuesStrs = append(valuesStrs, fmt.Sprintf("($%v,$%v,$%v,$%v,$%v)",
+			i*5+1, i*5+2, i*5+3, i*5+4, i*5+5))
+		params = append(params, sqlNodes[i].hash, sqlNodes[i].children,
+			sqlNodes[i].nodeType, name, identity)
 	}
 
 	query = fmt.Sprintf(
 		`
-INSERT INTO %[1]v (hash, children)
+INSERT INTO %[1]v (hash, children, type, submitter, submitter_identity)
 VALUES %[2]v
-ON CONFLICT DO NOTHING`,
+ON CONFLICT DO NOTHING
+RETURNING hash`,
 		quote(tableMtNode), strings.Join(valuesStrs, ","))
 
 	return query, params, nil
 }
 
+// pgText returns NULL for an empty string
+func pgText(s string) pgtype.Text {
+	if s == "" {
+		return pgtype.Text{Status: pgtype.Null}
+	}
+	return pgtype.Text{String: s, Status: pgtype.Present}
+}
+
+// Validate checks the node before saving it to storage.
+func (n Node) Validate() error {
+	valid, err := n.IsValid()
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return errors.WithStack(ErrIncorrectHash)
+	}
+
+	if n.Hash == merkletree.HashZero {
+		return errors.New("node hash zero hash")
+	}
+
+	return nil
+}
+
 func (p *pgStorage) ByHash(ctx context.Context,
 	hash merkletree.Hash) (Node, error) {
 
@@ -255,20 +469,158 @@ func (p *pgStorage) ByHash(ctx context.Context,
 		return node, errors.WithStack(err)
 	}
 
+	node.Children, err = childrenFromPg(pgChildren)
+	return node, err
+}
+
+// ByHashWithMeta implements NodeMetaGetter.
+func (p *pgStorage) ByHashWithMeta(ctx context.Context,
+	hash merkletree.Hash) (Node, error) {
+
+	var node = Node{Hash: hash, Meta: &NodeMeta{}}
+
+	var pgChildren pgtype.ByteaArray
+	var firstSeen pgtype.Timestamptz
+	var submitter, identity pgtype.Text
+	query := fmt.Sprintf(`
+SELECT children, first_seen_at, submitter, submitter_identity
+FROM %[1]v WHERE hash = $1`, quote(tableMtNode))
+	err := p.db.QueryRow(ctx, query, hash[:]).
+		Scan(&pgChildren, &firstSeen, &submitter, &identity)
+	switch err {
+	case pgx.ErrNoRows:
+		return Node{Hash: hash}, errors.WithStack(ErrDoesNotExists)
+	case nil:
+	default:
+		return Node{Hash: hash}, errors.WithStack(err)
+	}
+
+	if firstSeen.Status == pgtype.Present {
+		node.Meta.FirstSeen = firstSeen.Time.UTC()
+	}
+	node.Meta.Submitter = submitter.String
+	node.Meta.SubmitterIdentity = identity.String
+	node.Children, err = childrenFromPg(pgChildren)
+	return node, err
+}
+
+func (p *pgStorage) ByHashes(ctx context.Context,
+	hashes []merkletree.Hash) ([]Node, error) {
+
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+
+	var pgHashes pgtype.ByteaArray
+	hashesB := make([][]byte, len(hashes))
+	for i := range hashes {
+		hashesB[i] = hashes[i][:]
+	}
+	err := pgHashes.Set(hashesB)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	query := fmt.Sprintf(
+		`SELECT hash, children FROM %[1]v WHERE hash = ANY($1)`,
+		quote(tableMtNode))
+	rows, err := p.db.Query(ctx, query, pgHashes)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var nodes []Node
+	for rows.Next() {
+		var hash []byte
+		var pgChildren pgtype.ByteaArray
+		err = rows.Scan(&hash, &pgChildren)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		var node Node
+		if len(hash) != len(node.Hash) {
+			return nil, errors.New(
+				"unexpected length of hash found in database")
+		}
+		copy(node.Hash[:], hash)
+		node.Children, err = childrenFromPg(pgChildren)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, errors.WithStack(rows.Err())
+}
+
+// ForEach iterates nodes in the order of insertion
+func (p *pgStorage) ForEach(ctx context.Context, fn func(Node) error) error {
+	query := fmt.Sprintf(`SELECT hash, children FROM %[1]v ORDER BY id`,
+		quote(tableMtNode))
+	rows, err := p.db.Query(ctx, query)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash []byte
+		var pgChildren pgtype.ByteaArray
+		err = rows.Scan(&hash, &pgChildren)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		var node Node
+		if len(hash) != len(node.Hash) {
+			return errors.New("unexpected length of hash found in database")
+		}
+		copy(node.Hash[:], hash)
+		node.Children, err = childrenFromPg(pgChildren)
+		if err != nil {
+			return err
+		}
+		if err = fn(node); err != nil {
+			return err
+		}
+	}
+	return errors.WithStack(rows.Err())
+}
+
+func childrenFromPg(pgChildren pgtype.ByteaArray) ([]merkletree.Hash,
+	error) {
+
 	var children [][]byte
 	if err := pgChildren.AssignTo(&children); err != nil {
-		return node, errors.WithStack(err)
+		return nil, errors.WithStack(err)
 	}
-	node.Children = make([]merkletree.Hash, len(children))
+	hashes := make([]merkletree.Hash, len(children))
 	for i := range children {
-		if len(children[i]) != len(node.Children[i]) {
-			return node, errors.New(
+		if len(children[i]) != len(hashes[i]) {
+			return nil, errors.New(
 				"unexpected length of hash found in database")
 		}
-		copy(node.Children[i][:], children[i])
+		copy(hashes[i][:], children[i])
 	}
+	return hashes, nil
+}
 
-	return node, nil
+// Ready checks that database is reachable and the schema is created.
+func (p *pgStorage) Ready(ctx context.Context) error {
+	var exists bool
+	err := p.db.QueryRow(ctx, `
+SELECT EXISTS (
+  SELECT 1 FROM pg_catalog.pg_tables
+  WHERE tablename = $1 AND schemaname = ANY(current_schemas(false)))`,
+		tableMtNode).Scan(&exists)
+	if err != nil {
+		return errors.Wrap(err, "database is not available")
+	}
+	if !exists {
+		return errors.Errorf("table %v does not exist", tableMtNode)
+	}
+	return nil
 }
 
 func quote(identifier string) string {
@@ -10,6 +10,7 @@ import (
 	"github.com/iden3/go-merkletree-sql"
 	"github.com/iden3/go-merkletree-sql/db/memory"
 	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
 	go_test_pg "github.com/olomix/go-test-pg"
 	"github.com/stretchr/testify/require"
 )
@@ -40,8 +41,13 @@ func TestPgStorage_ByHash(t *testing.T) {
 	)
 
 	ctx := context.Background()
-	err := storage.SaveNodes(ctx, []Node{n1, n2})
+	inserted, err := storage.SaveNodes(ctx, []Node{n1, n2})
 	require.NoError(t, err)
+	require.ElementsMatch(t, []merkletree.Hash{n1.Hash, n2.Hash}, inserted)
+
+	inserted, err = storage.SaveNodes(ctx, []Node{n1})
+	require.NoError(t, err)
+	require.Empty(t, inserted)
 
 	n3, err := storage.ByHash(ctx, n1.Hash)
 	require.NoError(t, err)
@@ -56,6 +62,95 @@ func TestPgStorage_ByHash(t *testing.T) {
 	require.EqualError(t, err, ErrDoesNotExists.Error())
 }
 
+func TestPgStorage_ByHashes(t *testing.T) {
+	storage := New(dbtest.WithEmpty(t))
+
+	n1 := makeNode(t,
+		"16938931282012536952003457515784019977456394464750325752202529629073057526316",
+		[]string{
+			"13668806873217811193138343672265398727158334092717678918544074543040898436197",
+			"6845643050256962634421298815823256099092239904213746305198440125223303121384",
+		},
+	)
+	n2 := makeNodeHex(t,
+		"658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e",
+		[]string{
+			"037c4d7bbb0407b8000000000000000000000000000000000000000000000000",
+			"0000000000000000000000000000000000000000000000000000000000000000",
+			"0100000000000000000000000000000000000000000000000000000000000000",
+		},
+	)
+
+	ctx := context.Background()
+	_, err := storage.SaveNodes(ctx, []Node{n1, n2})
+	require.NoError(t, err)
+
+	missingHash := hashFromIntString(t, "1")
+	nodes, err := storage.ByHashes(ctx,
+		[]merkletree.Hash{n1.Hash, missingHash, n2.Hash})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []Node{n1, n2}, nodes)
+
+	nodes, err = storage.ByHashes(ctx, []merkletree.Hash{missingHash})
+	require.NoError(t, err)
+	require.Empty(t, nodes)
+
+	nodes, err = storage.ByHashes(ctx, nil)
+	require.NoError(t, err)
+	require.Empty(t, nodes)
+}
+
+func TestPgStorage_ForEach(t *testing.T) {
+	storage := New(dbtest.WithEmpty(t))
+	ctx := context.Background()
+
+	require.Empty(t, allNodes(t, storage))
+
+	n1 := makeNode(t,
+		"16938931282012536952003457515784019977456394464750325752202529629073057526316",
+		[]string{
+			"13668806873217811193138343672265398727158334092717678918544074543040898436197",
+			"6845643050256962634421298815823256099092239904213746305198440125223303121384",
+		},
+	)
+	n2 := makeNodeHex(t,
+		"658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e",
+		[]string{
+			"037c4d7bbb0407b8000000000000000000000000000000000000000000000000",
+			"0000000000000000000000000000000000000000000000000000000000000000",
+			"0100000000000000000000000000000000000000000000000000000000000000",
+		},
+	)
+	_, err := storage.SaveNodes(ctx, []Node{n1, n2})
+	require.NoError(t, err)
+
+	// nodes are returned in the order of insertion
+	require.Equal(t, []Node{n1, n2}, allNodes(t, storage))
+}
+
+// allNodes returns all nodes from storage using ForEach
+func allNodes(t testing.TB, storage Storage) []Node {
+	var nodes []Node
+	err := storage.ForEach(context.Background(), func(n Node) error {
+		nodes = append(nodes, n)
+		return nil
+	})
+	require.NoError(t, err)
+	return nodes
+}
+
+func TestPgStorage_Ready(t *testing.T) {
+	db := dbtest.WithEmpty(t)
+	storage := New(db)
+	ctx := context.Background()
+
+	require.NoError(t, storage.Ready(ctx))
+
+	_, err := db.Exec(ctx, "DROP TABLE mt_node")
+	require.NoError(t, err)
+	require.EqualError(t, storage.Ready(ctx), "table mt_node does not exist")
+}
+
 func TestHashChildren(t *testing.T) {
 	testCases := []struct {
 		title    string
@@ -178,6 +273,40 @@ func TestNode_UnmarshalJSON(t *testing.T) {
 }`,
 			wantErr: "node hash is not correct",
 		},
+		{
+			title: "leaf node with type",
+			in: `{
+  "hash": "658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e",
+  "children": [
+    "037c4d7bbb0407b8000000000000000000000000000000000000000000000000",
+    "0000000000000000000000000000000000000000000000000000000000000000",
+    "0100000000000000000000000000000000000000000000000000000000000000"
+  ],
+  "type": "leaf"
+}`,
+			want: makeNode(t,
+				"13668806873217811193138343672265398727158334092717678918544074543040898436197",
+				[]string{
+					"13260572831089785859",
+					"0",
+					"1",
+				},
+			),
+		},
+		{
+			title: "incorrect type",
+			in: `{
+  "hash": "658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e",
+  "children": [
+    "037c4d7bbb0407b8000000000000000000000000000000000000000000000000",
+    "0000000000000000000000000000000000000000000000000000000000000000",
+    "0100000000000000000000000000000000000000000000000000000000000000"
+  ],
+  "type": "state"
+}`,
+			wantErr: "'type' value does not match children: " +
+				"expected leaf, got state",
+		},
 	}
 
 	for i := range testCases {
@@ -202,7 +331,8 @@ func TestNode_MarshalJSON(t *testing.T) {
     "037c4d7bbb0407b8000000000000000000000000000000000000000000000000",
     "0000000000000000000000000000000000000000000000000000000000000000",
     "0100000000000000000000000000000000000000000000000000000000000000"
-  ]
+  ],
+  "type": "leaf"
 }`
 	node := makeNode(t,
 		"13668806873217811193138343672265398727158334092717678918544074543040898436197",
@@ -250,15 +380,21 @@ func TestMkInsertNodesSQL(t *testing.T) {
 		middleNode.Children[1][:]})
 	require.NoError(t, err)
 
-	query, params, err := mkInsertNodesSQL([]Node{nodeLeaf, middleNode})
+	query, params, err := mkInsertNodesSQL([]Node{nodeLeaf, middleNode},
+		submitter{name: "alice"})
 	require.NoError(t, err)
 	wantQuery := `
-INSERT INTO "mt_node" (hash, children)
-VALUES ($1,$2),($3,$4)
-ON CONFLICT DO NOTHING`
+INSERT INTO "mt_node" (hash, children, type, submitter, submitter_identity)
+VALUES ($1,$2,$3,$4,$5),($6,$7,$8,$9,$10)
+ON CONFLICT DO NOTHING
+RETURNING hash`
 	require.Equal(t, wantQuery, query)
+	name := pgtype.Text{String: "alice", Status: pgtype.Present}
+	identity := pgtype.Text{Status: pgtype.Null}
 	wantParams := []interface{}{
-		leafNodeHash, leafNodeChildren, middleNodeHash, middleNodeChildren}
+		leafNodeHash, leafNodeChildren, int16(NodeTypeLeaf), name, identity,
+		middleNodeHash, middleNodeChildren, int16(NodeTypeMiddle), name,
+		identity}
 	require.Equal(t, wantParams, params)
 }
 
@@ -302,12 +438,106 @@ func TestChunkedNodeSaving(t *testing.T) {
 	require.True(t, len(nodes) > insertNodeChunkSize)
 
 	storage := New(dbtest.WithEmpty(t))
-	err = storage.SaveNodes(ctx, nodes)
+	inserted, err := storage.SaveNodes(ctx, nodes)
+	require.NoError(t, err)
+	require.Len(t, inserted, len(nodes))
+
+	for _, n := range nodes {
+		node, err := storage.ByHash(ctx, n.Hash)
+		require.NoError(t, err)
+		require.Equal(t, n, node)
+	}
+}
+
+func TestCopyNodes(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 40)
 	require.NoError(t, err)
+	for i := int64(1); i <= 100; i++ {
+		err = mt.Add(ctx, big.NewInt(i), big.NewInt(10))
+		require.NoError(t, err)
+	}
+	nodes := treeNodes(t, mt)
+
+	db := dbtest.WithEmpty(t)
+	storage := New(db)
+	// some nodes already exist
+	_, err = storage.SaveNodes(WithSubmitter(ctx, "alice"), nodes[:10])
+	require.NoError(t, err)
+
+	var inserted []merkletree.Hash
+	err = db.BeginFunc(ctx, func(tx pgx.Tx) error {
+		// duplicates in one batch are allowed
+		inserted, err = copyNodes(ctx, tx, append(nodes, nodes[len(nodes)-1]),
+			submitter{identity: "bob"})
+		return err
+	})
+	require.NoError(t, err)
+	var wantInserted []merkletree.Hash
+	for _, n := range nodes[10:] {
+		wantInserted = append(wantInserted, n.Hash)
+	}
+	require.ElementsMatch(t, wantInserted, inserted)
 
 	for _, n := range nodes {
 		node, err := storage.ByHash(ctx, n.Hash)
 		require.NoError(t, err)
 		require.Equal(t, n, node)
 	}
+
+	// nodes are attributed to the first submitter
+	var byName, byIdentity int
+	err = db.QueryRow(ctx, `
+SELECT count(*) FILTER (WHERE submitter = 'alice'),
+       count(*) FILTER (WHERE submitter_identity = 'bob')
+FROM mt_node`).Scan(&byName, &byIdentity)
+	require.NoError(t, err)
+	require.Equal(t, 10, byName)
+	require.Equal(t, len(nodes)-10, byIdentity)
+
+	err = db.BeginFunc(ctx, func(tx pgx.Tx) error {
+		_, err = copyNodes(ctx, tx, []Node{{
+			Hash:     hashFromIntString(t, "1"),
+			Children: nodes[0].Children,
+		}}, submitter{})
+		return err
+	})
+	require.ErrorIs(t, err, ErrIncorrectHash)
+}
+
+func TestNode_Type(t *testing.T) {
+	testCases := []struct {
+		title    string
+		children []string
+		want     NodeType
+	}{
+		{
+			title:    "middle node",
+			children: []string{"1", "2"},
+			want:     NodeTypeMiddle,
+		},
+		{
+			title:    "leaf node",
+			children: []string{"13260572831089785859", "0", "1"},
+			want:     NodeTypeLeaf,
+		},
+		{
+			title:    "state node",
+			children: []string{"5", "0", "0"},
+			want:     NodeTypeState,
+		},
+		{
+			title:    "unknown node",
+			children: []string{"1", "2", "3", "4"},
+			want:     NodeTypeUnknown,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.title, func(t *testing.T) {
+			node := makeNode(t, "1", tc.children)
+			require.Equal(t, tc.want, node.Type())
+		})
+	}
 }
@@ -0,0 +1,144 @@
+package hashdb
+
+import (
+	"context"
+	"sync"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/pkg/errors"
+)
+
+type memStorage struct {
+	mu    sync.RWMutex
+	nodes map[merkletree.Hash]Node
+	metas map[merkletree.Hash]NodeMeta
+}
+
+// NewMemory creates storage that keeps nodes in memory. It validates nodes
+// the same way the database storage does. Useful for tests and for
+// embedding RHS into other applications.
+func NewMemory() Storage {
+	return &memStorage{
+		nodes: make(map[merkletree.Hash]Node),
+		metas: make(map[merkletree.Hash]NodeMeta),
+	}
+}
+
+// SaveNodes inserts nodes that are not stored yet. If any node is invalid
+// or the submission can't be logged (see WithSubmissionLog), none of nodes
+// are saved.
+func (m *memStorage) SaveNodes(ctx context.Context,
+	nodes []Node) ([]merkletree.Hash, error) {
+
+	for i := range nodes {
+		if err := nodes[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	s := submitterFrom(ctx)
+	meta := NodeMeta{publishTime(), s.name, s.identity}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var inserted []merkletree.Hash
+	newNodes := make(map[merkletree.Hash]struct{})
+	for i := range nodes {
+		_, ok := m.nodes[nodes[i].Hash]
+		if _, dup := newNodes[nodes[i].Hash]; ok || dup {
+			continue
+		}
+		newNodes[nodes[i].Hash] = struct{}{}
+		inserted = append(inserted, nodes[i].Hash)
+	}
+
+	if hook, ok := submissionHookFrom(ctx); ok {
+		_, err := hook.log.LogSubmission(ctx,
+			hook.submission(ctx, len(nodes), inserted))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to log submission")
+		}
+	}
+
+	for i := range nodes {
+		if _, ok := newNodes[nodes[i].Hash]; ok {
+			m.nodes[nodes[i].Hash] = copyNode(nodes[i])
+			m.metas[nodes[i].Hash] = meta
+		}
+	}
+	return inserted, nil
+}
+
+func (m *memStorage) ByHash(_ context.Context,
+	hash merkletree.Hash) (Node, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, ok := m.nodes[hash]
+	if !ok {
+		return Node{Hash: hash}, errors.WithStack(ErrDoesNotExists)
+	}
+	return copyNode(n), nil
+}
+
+// ByHashWithMeta implements NodeMetaGetter.
+func (m *memStorage) ByHashWithMeta(ctx context.Context,
+	hash merkletree.Hash) (Node, error) {
+
+	n, err := m.ByHash(ctx, hash)
+	if err != nil {
+		return n, err
+	}
+	m.mu.RLock()
+	meta := m.metas[hash]
+	m.mu.RUnlock()
+	n.Meta = &meta
+	return n, nil
+}
+
+func (m *memStorage) ByHashes(_ context.Context,
+	hashes []merkletree.Hash) ([]Node, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var nodes []Node
+	seen := make(map[merkletree.Hash]struct{}, len(hashes))
+	for _, h := range hashes {
+		if _, ok := seen[h]; ok {
+			continue
+		}
+		seen[h] = struct{}{}
+		if n, ok := m.nodes[h]; ok {
+			nodes = append(nodes, copyNode(n))
+		}
+	}
+	return nodes, nil
+}
+
+// ForEach iterates a snapshot of nodes taken at the call, in no particular
+// order. Nodes saved during iteration are not visited.
+func (m *memStorage) ForEach(_ context.Context, fn func(Node) error) error {
+	m.mu.RLock()
+	nodes := make([]Node, 0, len(m.nodes))
+	for _, n := range m.nodes {
+		nodes = append(nodes, copyNode(n))
+	}
+	m.mu.RUnlock()
+
+	for i := range nodes {
+		if err := fn(nodes[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memStorage) Ready(_ context.Context) error {
+	return nil
+}
+
+// copyNode returns a node that does not share children with the original
+func copyNode(n Node) Node {
+	children := make([]merkletree.Hash, len(n.Children))
+	copy(children, n.Children)
+	return Node{Hash: n.Hash, Children: children}
+}
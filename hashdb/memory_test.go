@@ -0,0 +1,95 @@
+package hashdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemStorage(t *testing.T) {
+	storage := NewMemory()
+
+	n1 := makeNode(t,
+		"16938931282012536952003457515784019977456394464750325752202529629073057526316",
+		[]string{
+			"13668806873217811193138343672265398727158334092717678918544074543040898436197",
+			"6845643050256962634421298815823256099092239904213746305198440125223303121384",
+		},
+	)
+	n2 := makeNodeHex(t,
+		"658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e",
+		[]string{
+			"037c4d7bbb0407b8000000000000000000000000000000000000000000000000",
+			"0000000000000000000000000000000000000000000000000000000000000000",
+			"0100000000000000000000000000000000000000000000000000000000000000",
+		},
+	)
+
+	ctx := context.Background()
+	require.NoError(t, storage.Ready(ctx))
+
+	inserted, err := storage.SaveNodes(ctx, []Node{n1, n2, n1})
+	require.NoError(t, err)
+	require.Equal(t, []merkletree.Hash{n1.Hash, n2.Hash}, inserted)
+	// saving the same nodes again is not an error
+	inserted, err = storage.SaveNodes(ctx, []Node{n2})
+	require.NoError(t, err)
+	require.Empty(t, inserted)
+
+	n3, err := storage.ByHash(ctx, n1.Hash)
+	require.NoError(t, err)
+	require.Equal(t, n1, n3)
+
+	// changing returned node does not affect storage
+	n3.Children[0] = merkletree.HashZero
+	n4, err := storage.ByHash(ctx, n1.Hash)
+	require.NoError(t, err)
+	require.Equal(t, n1, n4)
+
+	missingHash := hashFromIntString(t, "1")
+	_, err = storage.ByHash(ctx, missingHash)
+	require.EqualError(t, err, ErrDoesNotExists.Error())
+
+	nodes, err := storage.ByHashes(ctx,
+		[]merkletree.Hash{n1.Hash, missingHash, n2.Hash, n1.Hash})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []Node{n1, n2}, nodes)
+
+	require.ElementsMatch(t, []Node{n1, n2}, allNodes(t, storage))
+
+	// iteration stops on error
+	errStop := errors.New("stop")
+	calls := 0
+	err = storage.ForEach(ctx, func(Node) error {
+		calls++
+		return errStop
+	})
+	require.Equal(t, errStop, err)
+	require.Equal(t, 1, calls)
+}
+
+func TestMemStorage_SaveInvalidNodes(t *testing.T) {
+	storage := NewMemory()
+	ctx := context.Background()
+
+	n1 := makeNode(t,
+		"16938931282012536952003457515784019977456394464750325752202529629073057526316",
+		[]string{
+			"13668806873217811193138343672265398727158334092717678918544074543040898436197",
+			"6845643050256962634421298815823256099092239904213746305198440125223303121384",
+		},
+	)
+	badNode := makeNode(t, "1", []string{"1", "2"})
+	_, err := storage.SaveNodes(ctx, []Node{n1, badNode})
+	require.EqualError(t, err, ErrIncorrectHash.Error())
+
+	// nothing is saved if one node is invalid
+	_, err = storage.ByHash(ctx, n1.Hash)
+	require.EqualError(t, err, ErrDoesNotExists.Error())
+
+	_, err = storage.SaveNodes(ctx, []Node{{Hash: merkletree.HashZero}})
+	require.EqualError(t, err, "node hash zero hash")
+}
@@ -0,0 +1,49 @@
+package hashdb
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/pkg/errors"
+)
+
+// NodeMeta describes how a node got to storage.
+type NodeMeta struct {
+	// time the node was saved first, zero for nodes saved before the time
+	// was recorded
+	FirstSeen time.Time
+	// name of the API key and the identity that submitted the node first,
+	// see WithSubmitter and WithSubmitterIdentity
+	Submitter         string
+	SubmitterIdentity string
+}
+
+func (m NodeMeta) MarshalJSON() ([]byte, error) {
+	// unknown values are reported as null
+	obj := map[string]interface{}{
+		"first_seen":         nil,
+		"submitter":          nil,
+		"submitter_identity": nil,
+	}
+	if !m.FirstSeen.IsZero() {
+		obj["first_seen"] = m.FirstSeen
+	}
+	if m.Submitter != "" {
+		obj["submitter"] = m.Submitter
+	}
+	if m.SubmitterIdentity != "" {
+		obj["submitter_identity"] = m.SubmitterIdentity
+	}
+	bytes, err := json.Marshal(obj)
+	return bytes, errors.WithStack(err)
+}
+
+// NodeMetaGetter is implemented by storages that keep node metadata.
+// Decorators like NewCache do not pass it through, so it is used on the
+// underlying storage.
+type NodeMetaGetter interface {
+	// ByHashWithMeta is ByHash that also sets Node.Meta
+	ByHashWithMeta(ctx context.Context, hash merkletree.Hash) (Node, error)
+}
@@ -0,0 +1,61 @@
+package hashdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testNodeMeta(t *testing.T, storage Storage) {
+	n := makeNodeHex(t,
+		"658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e",
+		[]string{
+			"037c4d7bbb0407b8000000000000000000000000000000000000000000000000",
+			"0000000000000000000000000000000000000000000000000000000000000000",
+			"0100000000000000000000000000000000000000000000000000000000000000",
+		},
+	)
+
+	ctx := context.Background()
+	t1 := time.Now()
+	_, err := storage.SaveNodes(WithSubmitterIdentity(
+		WithSubmitter(ctx, "alice"), "did:iden3:x1"), []Node{n})
+	require.NoError(t, err)
+	// metadata is kept from the first submission
+	_, err = storage.SaveNodes(WithSubmitter(ctx, "bob"), []Node{n})
+	require.NoError(t, err)
+
+	meta := storage.(NodeMetaGetter)
+	n2, err := meta.ByHashWithMeta(ctx, n.Hash)
+	require.NoError(t, err)
+	require.Equal(t, n.Hash, n2.Hash)
+	require.Equal(t, n.Children, n2.Children)
+	require.NotNil(t, n2.Meta)
+	require.Equal(t, "alice", n2.Meta.Submitter)
+	require.Equal(t, "did:iden3:x1", n2.Meta.SubmitterIdentity)
+	require.WithinDuration(t, t1, n2.Meta.FirstSeen, time.Minute)
+
+	// ByHash does not return metadata
+	n3, err := storage.ByHash(ctx, n.Hash)
+	require.NoError(t, err)
+	require.Nil(t, n3.Meta)
+
+	_, err = meta.ByHashWithMeta(ctx, hashFromIntString(t, "1"))
+	require.ErrorIs(t, err, ErrDoesNotExists)
+}
+
+func TestMemStorage_ByHashWithMeta(t *testing.T) {
+	testNodeMeta(t, NewMemory())
+}
+
+func TestBoltStorage_ByHashWithMeta(t *testing.T) {
+	storage, err := NewBolt(newBoltDB(t))
+	require.NoError(t, err)
+	testNodeMeta(t, storage)
+}
+
+func TestPgStorage_ByHashWithMeta(t *testing.T) {
+	testNodeMeta(t, New(dbtest.WithEmpty(t)))
+}
@@ -0,0 +1,96 @@
+package hashdb
+
+import (
+	"context"
+	"encoding/json"
+	stderr "errors"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/pkg/errors"
+)
+
+var ErrUnexpectedNodeType = stderr.New("unexpected node type")
+
+type NodeAux struct {
+	Key   merkletree.Hash
+	Value merkletree.Hash
+}
+
+func (n NodeAux) MarshalJSON() ([]byte, error) {
+	bytes, err := json.Marshal(map[string]interface{}{
+		"key":   n.Key.Hex(),
+		"value": n.Value.Hex(),
+	})
+	return bytes, errors.WithStack(err)
+}
+
+// Proof is a proof of existence or non-existence of a key in a sparse
+// merkle tree. Siblings are listed from the root down to the leaf.
+type Proof struct {
+	Existence bool
+	Siblings  []merkletree.Hash
+	NodeAux   *NodeAux
+}
+
+func (p Proof) MarshalJSON() ([]byte, error) {
+	siblings := make([]string, len(p.Siblings))
+	for i := range p.Siblings {
+		siblings[i] = p.Siblings[i].Hex()
+	}
+	obj := map[string]interface{}{
+		"existence": p.Existence,
+		"siblings":  siblings}
+	if p.NodeAux != nil {
+		obj["aux_node"] = p.NodeAux
+	}
+	bytes, err := json.Marshal(obj)
+	return bytes, errors.WithStack(err)
+}
+
+type nodeGetter interface {
+	ByHash(ctx context.Context, hash merkletree.Hash) (Node, error)
+}
+
+// GenerateProof walks the tree from treeRoot down to the key and collects
+// siblings. If some node on the path is missing from storage,
+// ErrDoesNotExists is returned.
+func GenerateProof(ctx context.Context, storage nodeGetter,
+	treeRoot merkletree.Hash, key merkletree.Hash) (Proof, error) {
+
+	nextKey := treeRoot
+	var p Proof
+	for depth := uint(0); depth < uint(len(key)*8); depth++ {
+		if nextKey == merkletree.HashZero {
+			return p, nil
+		}
+		n, err := storage.ByHash(ctx, nextKey)
+		if err != nil {
+			return p, err
+		}
+		switch nt := n.Type(); nt {
+		case NodeTypeLeaf:
+			if key == n.Children[0] {
+				p.Existence = true
+				return p, nil
+			}
+			// We found a leaf whose entry didn't match the key
+			p.NodeAux = &NodeAux{Key: n.Children[0], Value: n.Children[1]}
+			return p, nil
+		case NodeTypeMiddle:
+			var siblingKey merkletree.Hash
+			if merkletree.TestBit(key[:], depth) {
+				nextKey = n.Children[1]
+				siblingKey = n.Children[0]
+			} else {
+				nextKey = n.Children[0]
+				siblingKey = n.Children[1]
+			}
+			p.Siblings = append(p.Siblings, siblingKey)
+		default:
+			return p, errors.Wrapf(ErrUnexpectedNodeType, "%v node %v",
+				nt, n.Hash.Hex())
+		}
+	}
+
+	return p, errors.New("tree depth is too high")
+}
@@ -0,0 +1,120 @@
+package hashdb
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/go-merkletree-sql/db/memory"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type nodesMap map[merkletree.Hash]Node
+
+func (m nodesMap) ByHash(_ context.Context,
+	hash merkletree.Hash) (Node, error) {
+
+	n, ok := m[hash]
+	if !ok {
+		return Node{Hash: hash}, errors.WithStack(ErrDoesNotExists)
+	}
+	return n, nil
+}
+
+func treeNodes(t testing.TB, mt *merkletree.MerkleTree) []Node {
+	var nodes []Node
+	err := mt.Walk(context.Background(), nil, func(n *merkletree.Node) {
+		hash, err := n.Key()
+		require.NoError(t, err)
+		n2 := Node{Hash: *hash}
+		switch n.Type {
+		case merkletree.NodeTypeMiddle:
+			n2.Children = append(n2.Children, *n.ChildL, *n.ChildR)
+		case merkletree.NodeTypeLeaf:
+			n2.Children = append(n2.Children,
+				*n.Entry[0], *n.Entry[1], hashOne)
+		case merkletree.NodeTypeEmpty:
+			return
+		default:
+			t.Fatalf("unexpected node type: %v", n.Type)
+		}
+		nodes = append(nodes, n2)
+	})
+	require.NoError(t, err)
+	return nodes
+}
+
+func TestGenerateProof(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 40)
+	require.NoError(t, err)
+	for _, k := range []int64{1, 3, 5, 7, 10, 100, 1000, 1001} {
+		err = mt.Add(ctx, big.NewInt(k), big.NewInt(0))
+		require.NoError(t, err)
+	}
+
+	storage := nodesMap{}
+	for _, n := range treeNodes(t, mt) {
+		storage[n.Hash] = n
+	}
+
+	for _, k := range []int64{1, 2, 5, 8, 31, 1000, 1002} {
+		key := big.NewInt(k)
+		wantProof, _, err := mt.GenerateProof(ctx, key, nil)
+		require.NoError(t, err)
+
+		proof, err := GenerateProof(ctx, storage, *mt.Root(),
+			*merkletree.NewHashFromBigInt(key))
+		require.NoError(t, err)
+
+		require.Equal(t, wantProof.Existence, proof.Existence, k)
+		wantSiblings := wantProof.AllSiblings()
+		require.Len(t, proof.Siblings, len(wantSiblings), k)
+		for i := range wantSiblings {
+			require.Equal(t, *wantSiblings[i], proof.Siblings[i], k)
+		}
+		if wantProof.NodeAux == nil {
+			require.Nil(t, proof.NodeAux, k)
+		} else {
+			require.Equal(t, &NodeAux{
+				Key:   *wantProof.NodeAux.Key,
+				Value: *wantProof.NodeAux.Value,
+			}, proof.NodeAux, k)
+		}
+	}
+
+	_, err = GenerateProof(ctx, nodesMap{}, *mt.Root(), hashOne)
+	require.ErrorIs(t, err, ErrDoesNotExists)
+}
+
+func TestProof_MarshalJSON(t *testing.T) {
+	p := Proof{
+		Existence: false,
+		Siblings: []merkletree.Hash{
+			hashFromIntString(t, "1"), merkletree.HashZero},
+		NodeAux: &NodeAux{
+			Key:   hashFromIntString(t, "5"),
+			Value: merkletree.HashZero,
+		},
+	}
+	data, err := json.Marshal(p)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+  "existence": false,
+  "siblings": [
+    "0100000000000000000000000000000000000000000000000000000000000000",
+    "0000000000000000000000000000000000000000000000000000000000000000"
+  ],
+  "aux_node": {
+    "key": "0500000000000000000000000000000000000000000000000000000000000000",
+    "value": "0000000000000000000000000000000000000000000000000000000000000000"
+  }
+}`, string(data))
+
+	data, err = json.Marshal(Proof{Existence: true})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"existence": true, "siblings": []}`, string(data))
+}
@@ -0,0 +1,264 @@
+package hashdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	stderr "errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+)
+
+const tableIdentityState = "identity_state"
+
+var bucketIdentityState = []byte(tableIdentityState)
+
+// ErrStateExists is returned when a state is published again. States of an
+// identity only move forward, so an old state can't become the latest one.
+var ErrStateExists = stderr.New("state is already registered")
+
+// StatePublication is a state of an identity published at PublishedAt.
+type StatePublication struct {
+	Identity    string
+	State       merkletree.Hash
+	PublishedAt time.Time
+}
+
+// StateRegistry keeps the history of identity states. The latest published
+// state is the current state of an identity. Registries do not check that
+// the state node is stored, callers do that.
+type StateRegistry interface {
+	// PublishState records state as the latest state of identity. Returns
+	// ErrStateExists if state was ever published for identity.
+	PublishState(ctx context.Context, identity string,
+		state merkletree.Hash) (StatePublication, error)
+	// LatestState returns ErrDoesNotExists if identity has no states
+	LatestState(ctx context.Context,
+		identity string) (StatePublication, error)
+	// States returns at most limit states of identity, latest first
+	States(ctx context.Context, identity string,
+		limit int) ([]StatePublication, error)
+}
+
+// publishTime returns current time in precision of PostgreSQL timestamps, so
+// all registries return the same times
+func publishTime() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+type pgStateRegistry struct {
+	db dbI
+}
+
+// NewStateRegistry creates a registry in PostgreSQL database.
+func NewStateRegistry(db dbI) StateRegistry {
+	return &pgStateRegistry{db}
+}
+
+func (p *pgStateRegistry) PublishState(ctx context.Context, identity string,
+	state merkletree.Hash) (StatePublication, error) {
+
+	pub := StatePublication{Identity: identity, State: state}
+	err := p.db.QueryRow(ctx, fmt.Sprintf(`
+INSERT INTO %v (identity, state) VALUES ($1, $2)
+ON CONFLICT (identity, state) DO NOTHING
+RETURNING published_at`, quote(tableIdentityState)),
+		identity, state[:]).Scan(&pub.PublishedAt)
+	if err == pgx.ErrNoRows {
+		return pub, errors.WithStack(ErrStateExists)
+	}
+	pub.PublishedAt = pub.PublishedAt.UTC()
+	return pub, errors.WithStack(err)
+}
+
+func (p *pgStateRegistry) LatestState(ctx context.Context,
+	identity string) (StatePublication, error) {
+
+	pubs, err := p.States(ctx, identity, 1)
+	if err != nil {
+		return StatePublication{}, err
+	}
+	if len(pubs) == 0 {
+		return StatePublication{}, errors.WithStack(ErrDoesNotExists)
+	}
+	return pubs[0], nil
+}
+
+func (p *pgStateRegistry) States(ctx context.Context, identity string,
+	limit int) ([]StatePublication, error) {
+
+	rows, err := p.db.Query(ctx, fmt.Sprintf(`
+SELECT state, published_at FROM %v
+WHERE identity = $1
+ORDER BY id DESC
+LIMIT $2`, quote(tableIdentityState)), identity, limit)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var pubs []StatePublication
+	for rows.Next() {
+		var state []byte
+		pub := StatePublication{Identity: identity}
+		if err = rows.Scan(&state, &pub.PublishedAt); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if len(state) != len(pub.State) {
+			return nil, errors.New(
+				"unexpected length of hash found in database")
+		}
+		copy(pub.State[:], state)
+		pub.PublishedAt = pub.PublishedAt.UTC()
+		pubs = append(pubs, pub)
+	}
+	return pubs, errors.WithStack(rows.Err())
+}
+
+type memStateRegistry struct {
+	mu     sync.RWMutex
+	states map[string][]StatePublication
+}
+
+// NewMemoryStateRegistry creates a registry that keeps states in memory.
+func NewMemoryStateRegistry() StateRegistry {
+	return &memStateRegistry{states: make(map[string][]StatePublication)}
+}
+
+func (m *memStateRegistry) PublishState(_ context.Context, identity string,
+	state merkletree.Hash) (StatePublication, error) {
+
+	pub := StatePublication{identity, state, publishTime()}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.states[identity] {
+		if p.State == state {
+			return pub, errors.WithStack(ErrStateExists)
+		}
+	}
+	m.states[identity] = append(m.states[identity], pub)
+	return pub, nil
+}
+
+func (m *memStateRegistry) LatestState(_ context.Context,
+	identity string) (StatePublication, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	pubs := m.states[identity]
+	if len(pubs) == 0 {
+		return StatePublication{}, errors.WithStack(ErrDoesNotExists)
+	}
+	return pubs[len(pubs)-1], nil
+}
+
+func (m *memStateRegistry) States(_ context.Context, identity string,
+	limit int) ([]StatePublication, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	pubs := m.states[identity]
+	var res []StatePublication
+	for i := len(pubs) - 1; i >= 0 && len(res) < limit; i-- {
+		res = append(res, pubs[i])
+	}
+	return res, nil
+}
+
+// boltStateRegistry keeps states of every identity in a nested bucket named
+// after the identity. Key is a big-endian sequence number and value is the
+// state hash followed by big-endian publication time in nanoseconds.
+type boltStateRegistry struct {
+	db *bbolt.DB
+}
+
+// NewBoltStateRegistry creates a registry in an opened bbolt database.
+// Required buckets are created if they do not exist.
+func NewBoltStateRegistry(db *bbolt.DB) (StateRegistry, error) {
+	err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketIdentityState)
+		return errors.WithStack(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &boltStateRegistry{db}, nil
+}
+
+func (b *boltStateRegistry) PublishState(_ context.Context, identity string,
+	state merkletree.Hash) (StatePublication, error) {
+
+	pub := StatePublication{identity, state, publishTime()}
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		bkt, err := tx.Bucket(bucketIdentityState).
+			CreateBucketIfNotExists([]byte(identity))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		err = bkt.ForEach(func(_, v []byte) error {
+			if bytes.HasPrefix(v, state[:]) {
+				return errors.WithStack(ErrStateExists)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		seq, err := bkt.NextSequence()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		var key [8]byte
+		binary.BigEndian.PutUint64(key[:], seq)
+		value := make([]byte, len(state)+8)
+		copy(value, state[:])
+		binary.BigEndian.PutUint64(value[len(state):],
+			uint64(pub.PublishedAt.UnixNano()))
+		return errors.WithStack(bkt.Put(key[:], value))
+	})
+	return pub, err
+}
+
+func (b *boltStateRegistry) LatestState(ctx context.Context,
+	identity string) (StatePublication, error) {
+
+	pubs, err := b.States(ctx, identity, 1)
+	if err != nil {
+		return StatePublication{}, err
+	}
+	if len(pubs) == 0 {
+		return StatePublication{}, errors.WithStack(ErrDoesNotExists)
+	}
+	return pubs[0], nil
+}
+
+func (b *boltStateRegistry) States(_ context.Context, identity string,
+	limit int) ([]StatePublication, error) {
+
+	var pubs []StatePublication
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(bucketIdentityState).Bucket([]byte(identity))
+		if bkt == nil {
+			return nil
+		}
+		c := bkt.Cursor()
+		for k, v := c.Last(); k != nil && len(pubs) < limit; k, v = c.Prev() {
+			pub := StatePublication{Identity: identity}
+			if len(v) != len(pub.State)+8 {
+				return errors.New("unexpected length of state in database")
+			}
+			copy(pub.State[:], v)
+			pub.PublishedAt = time.Unix(0,
+				int64(binary.BigEndian.Uint64(v[len(pub.State):]))).UTC()
+			pubs = append(pubs, pub)
+		}
+		return nil
+	})
+	return pubs, err
+}
@@ -0,0 +1,65 @@
+package hashdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/stretchr/testify/require"
+)
+
+func testStateRegistry(t *testing.T, states StateRegistry) {
+	ctx := context.Background()
+	const identity = "114vgnnCupQMX4wqUBjg5kUya3zMXfPmKc9HNH4TSE"
+
+	_, err := states.LatestState(ctx, identity)
+	require.ErrorIs(t, err, ErrDoesNotExists)
+	pubs, err := states.States(ctx, identity, 10)
+	require.NoError(t, err)
+	require.Empty(t, pubs)
+
+	var published []StatePublication
+	for _, s := range []merkletree.Hash{{1}, {2}, {3}, {4}} {
+		pub, err := states.PublishState(ctx, identity, s)
+		require.NoError(t, err)
+		require.Equal(t, identity, pub.Identity)
+		require.Equal(t, s, pub.State)
+		require.False(t, pub.PublishedAt.IsZero())
+		published = append(published, pub)
+	}
+	_, err = states.PublishState(ctx, "other", merkletree.Hash{4})
+	require.NoError(t, err)
+
+	// old states can't be published again
+	for _, s := range []merkletree.Hash{{2}, {4}} {
+		_, err = states.PublishState(ctx, identity, s)
+		require.ErrorIs(t, err, ErrStateExists)
+	}
+
+	latest, err := states.LatestState(ctx, identity)
+	require.NoError(t, err)
+	require.Equal(t, published[3], latest)
+
+	pubs, err = states.States(ctx, identity, 10)
+	require.NoError(t, err)
+	require.Equal(t, []StatePublication{published[3], published[2],
+		published[1], published[0]}, pubs)
+
+	pubs, err = states.States(ctx, identity, 2)
+	require.NoError(t, err)
+	require.Equal(t, []StatePublication{published[3], published[2]}, pubs)
+}
+
+func TestMemoryStateRegistry(t *testing.T) {
+	testStateRegistry(t, NewMemoryStateRegistry())
+}
+
+func TestBoltStateRegistry(t *testing.T) {
+	states, err := NewBoltStateRegistry(newBoltDB(t))
+	require.NoError(t, err)
+	testStateRegistry(t, states)
+}
+
+func TestPgStateRegistry(t *testing.T) {
+	testStateRegistry(t, NewStateRegistry(dbtest.WithEmpty(t)))
+}
@@ -0,0 +1,95 @@
+package hashdb
+
+import (
+	"context"
+	stderr "errors"
+	"fmt"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/pkg/errors"
+)
+
+// ErrUnsupportedShape is returned in strict mode for nodes the iden3
+// protocol never produces.
+var ErrUnsupportedShape = stderr.New("node shape is not supported")
+
+// NodeError is an error of a single node passed to SaveNodes.
+type NodeError struct {
+	// index of the node in SaveNodes argument
+	Index int
+	Hash  merkletree.Hash
+	Err   error
+}
+
+func (e NodeError) Error() string {
+	return fmt.Sprintf("node #%v (%v): %v", e.Index+1, e.Hash.Hex(), e.Err)
+}
+
+func (e NodeError) Unwrap() error {
+	return e.Err
+}
+
+// NodeErrors lists all invalid nodes of a SaveNodes call.
+type NodeErrors []NodeError
+
+func (e NodeErrors) Error() string {
+	switch len(e) {
+	case 0:
+		return "no node errors"
+	case 1:
+		return e[0].Error()
+	default:
+		return fmt.Sprintf("%v invalid nodes, first one is %v", len(e), e[0])
+	}
+}
+
+// ValidateStrict checks the node like Validate does and also rejects shapes
+// the iden3 protocol never produces. Allowed nodes are middle nodes with two
+// children, not both of them empty, leaves with three children where the
+// last one is 1, and state nodes with three children.
+func (n Node) ValidateStrict() error {
+	if err := n.Validate(); err != nil {
+		return err
+	}
+
+	switch n.Type() {
+	case NodeTypeUnknown:
+		return errors.Wrapf(ErrUnsupportedShape, "%v children",
+			len(n.Children))
+	case NodeTypeMiddle:
+		if n.Children[0] == merkletree.HashZero &&
+			n.Children[1] == merkletree.HashZero {
+
+			return errors.Wrap(ErrUnsupportedShape,
+				"middle node with both children empty")
+		}
+	}
+	return nil
+}
+
+// strictStorage rejects nodes failing ValidateStrict
+type strictStorage struct {
+	Storage
+}
+
+// NewStrict wraps storage to check nodes with ValidateStrict before saving.
+// If any node is invalid, none of nodes are saved and NodeErrors listing all
+// invalid nodes is returned.
+func NewStrict(s Storage) Storage {
+	return &strictStorage{s}
+}
+
+func (s *strictStorage) SaveNodes(ctx context.Context,
+	nodes []Node) ([]merkletree.Hash, error) {
+
+	var nodeErrs NodeErrors
+	for i := range nodes {
+		if err := nodes[i].ValidateStrict(); err != nil {
+			nodeErrs = append(nodeErrs, NodeError{i, nodes[i].Hash, err})
+		}
+	}
+	if len(nodeErrs) != 0 {
+		return nil, errors.WithStack(nodeErrs)
+	}
+	return s.Storage.SaveNodes(ctx, nodes)
+}
@@ -0,0 +1,96 @@
+package hashdb
+
+import (
+	"context"
+	stderr "errors"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/stretchr/testify/require"
+)
+
+// nodeOf returns a node with correct hash of children
+func nodeOf(t testing.TB, children ...merkletree.Hash) Node {
+	n := Node{Children: children}
+	var err error
+	n.Hash, err = n.hashChildren()
+	require.NoError(t, err)
+	return n
+}
+
+func TestNode_ValidateStrict(t *testing.T) {
+	h1 := hashFromIntString(t, "1")
+	h2 := hashFromIntString(t, "2")
+	h3 := hashFromIntString(t, "3")
+	zero := merkletree.HashZero
+
+	testCases := []struct {
+		title   string
+		node    Node
+		wantErr error
+	}{
+		{title: "middle", node: nodeOf(t, h2, h3)},
+		{title: "middle with one empty child", node: nodeOf(t, zero, h3)},
+		{title: "leaf", node: nodeOf(t, h2, h3, h1)},
+		{title: "state", node: nodeOf(t, h2, h3, zero)},
+		{
+			title:   "middle with empty children",
+			node:    nodeOf(t, zero, zero),
+			wantErr: ErrUnsupportedShape,
+		},
+		{
+			title:   "one child",
+			node:    nodeOf(t, h2),
+			wantErr: ErrUnsupportedShape,
+		},
+		{
+			title:   "four children",
+			node:    nodeOf(t, h2, h3, h1, h1),
+			wantErr: ErrUnsupportedShape,
+		},
+		{
+			title:   "incorrect hash",
+			node:    Node{Hash: h1, Children: []merkletree.Hash{h2, h3}},
+			wantErr: ErrIncorrectHash,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.title, func(t *testing.T) {
+			err := tc.node.ValidateStrict()
+			if tc.wantErr == nil {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestStrictStorage(t *testing.T) {
+	ctx := context.Background()
+	storage := NewStrict(NewMemory())
+
+	good := nodeOf(t, hashFromIntString(t, "2"), hashFromIntString(t, "3"))
+	bad1 := nodeOf(t, hashFromIntString(t, "2"))
+	bad2 := nodeOf(t, merkletree.HashZero, merkletree.HashZero)
+
+	_, err := storage.SaveNodes(ctx, []Node{bad1, good, bad2})
+	var nodeErrs NodeErrors
+	require.True(t, stderr.As(err, &nodeErrs))
+	require.Len(t, nodeErrs, 2)
+	require.Equal(t, 0, nodeErrs[0].Index)
+	require.Equal(t, bad1.Hash, nodeErrs[0].Hash)
+	require.Equal(t, 2, nodeErrs[1].Index)
+	require.Equal(t, bad2.Hash, nodeErrs[1].Hash)
+	require.ErrorIs(t, nodeErrs[1], ErrUnsupportedShape)
+
+	// nothing is saved if any node is invalid
+	_, err = storage.ByHash(ctx, good.Hash)
+	require.ErrorIs(t, err, ErrDoesNotExists)
+
+	inserted, err := storage.SaveNodes(ctx, []Node{good})
+	require.NoError(t, err)
+	require.Equal(t, []merkletree.Hash{good.Hash}, inserted)
+}
@@ -0,0 +1,332 @@
+package hashdb
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+)
+
+const tableNodeSubmission = "node_submission"
+
+var bucketNodeSubmission = []byte(tableNodeSubmission)
+
+// Submission is a record of a successful node submission.
+type Submission struct {
+	RequestID         string
+	Submitter         string
+	SubmitterIdentity string
+	SubmittedAt       time.Time
+	// number of submitted nodes
+	Nodes int
+	// hashes of submitted nodes that were new to the storage
+	Inserted []merkletree.Hash
+}
+
+// SubmissionFilter selects submissions. Zero fields match all submissions.
+type SubmissionFilter struct {
+	Submitter         string
+	SubmitterIdentity string
+	// submissions that inserted the node
+	Hash *merkletree.Hash
+	// submitted at or after Since and before Until
+	Since time.Time
+	Until time.Time
+	// maximum number of returned submissions
+	Limit int
+}
+
+func (f SubmissionFilter) match(s Submission) bool {
+	if f.Submitter != "" && f.Submitter != s.Submitter {
+		return false
+	}
+	if f.SubmitterIdentity != "" &&
+		f.SubmitterIdentity != s.SubmitterIdentity {
+		return false
+	}
+	if !f.Since.IsZero() && s.SubmittedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !s.SubmittedAt.Before(f.Until) {
+		return false
+	}
+	if f.Hash != nil {
+		for _, h := range s.Inserted {
+			if h == *f.Hash {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// SubmissionLog keeps the audit log of node submissions.
+type SubmissionLog interface {
+	// LogSubmission records s, SubmittedAt is set to the current time
+	LogSubmission(ctx context.Context, s Submission) (Submission, error)
+	// Submissions returns submissions matching f, latest first
+	Submissions(ctx context.Context,
+		f SubmissionFilter) ([]Submission, error)
+}
+
+type submissionLogCtxKey struct{}
+
+// submissionHook is the submission log and the request ID set with
+// WithSubmissionLog
+type submissionHook struct {
+	log       SubmissionLog
+	requestID string
+}
+
+// WithSubmissionLog returns a context that makes SaveNodes record nodes
+// saved with it in subs as a submission of request requestID. If subs is
+// kept in the same database as nodes, the submission is recorded in the same
+// transaction, so nodes are not saved unless the submission is logged and a
+// retried request is logged with the nodes it inserts.
+func WithSubmissionLog(ctx context.Context, subs SubmissionLog,
+	requestID string) context.Context {
+
+	return context.WithValue(ctx, submissionLogCtxKey{},
+		submissionHook{subs, requestID})
+}
+
+func submissionHookFrom(ctx context.Context) (submissionHook, bool) {
+	hook, ok := ctx.Value(submissionLogCtxKey{}).(submissionHook)
+	return hook, ok
+}
+
+// submission returns the submission of nodes saved with ctx
+func (h submissionHook) submission(ctx context.Context, nodes int,
+	inserted []merkletree.Hash) Submission {
+
+	s := submitterFrom(ctx)
+	return Submission{
+		RequestID:         h.requestID,
+		Submitter:         s.name,
+		SubmitterIdentity: s.identity,
+		Nodes:             nodes,
+		Inserted:          inserted,
+	}
+}
+
+type pgSubmissionLog struct {
+	db dbI
+}
+
+// NewSubmissionLog creates a submission log in PostgreSQL database.
+func NewSubmissionLog(db dbI) SubmissionLog {
+	return &pgSubmissionLog{db}
+}
+
+func (p *pgSubmissionLog) LogSubmission(ctx context.Context,
+	s Submission) (Submission, error) {
+
+	return insertSubmission(ctx, p.db, s)
+}
+
+// insertSubmission records s in db, which may be a transaction that saves
+// submitted nodes
+func insertSubmission(ctx context.Context, db dbI,
+	s Submission) (Submission, error) {
+
+	hashes := make([][]byte, len(s.Inserted))
+	for i := range s.Inserted {
+		hashes[i] = s.Inserted[i][:]
+	}
+	err := db.QueryRow(ctx, fmt.Sprintf(`
+INSERT INTO %v
+    (request_id, submitter, submitter_identity, nodes, inserted, hashes)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING submitted_at`, quote(tableNodeSubmission)),
+		s.RequestID, pgText(s.Submitter), pgText(s.SubmitterIdentity),
+		s.Nodes, len(s.Inserted), hashes).Scan(&s.SubmittedAt)
+	s.SubmittedAt = s.SubmittedAt.UTC()
+	return s, errors.WithStack(err)
+}
+
+func (p *pgSubmissionLog) Submissions(ctx context.Context,
+	f SubmissionFilter) ([]Submission, error) {
+
+	var conds []string
+	var params []interface{}
+	addCond := func(cond string, param interface{}) {
+		params = append(params, param)
+		conds = append(conds, fmt.Sprintf(cond, len(params)))
+	}
+	if f.Submitter != "" {
+		addCond("submitter = $%v", f.Submitter)
+	}
+	if f.SubmitterIdentity != "" {
+		addCond("submitter_identity = $%v", f.SubmitterIdentity)
+	}
+	if f.Hash != nil {
+		addCond("hashes @> ARRAY[$%v::BYTEA]", f.Hash[:])
+	}
+	if !f.Since.IsZero() {
+		addCond("submitted_at >= $%v", f.Since)
+	}
+	if !f.Until.IsZero() {
+		addCond("submitted_at < $%v", f.Until)
+	}
+	where := ""
+	if len(conds) != 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+	params = append(params, f.Limit)
+
+	rows, err := p.db.Query(ctx, fmt.Sprintf(`
+SELECT request_id, submitter, submitter_identity, submitted_at, nodes,
+       hashes
+FROM %v
+%v
+ORDER BY id DESC
+LIMIT $%v`, quote(tableNodeSubmission), where, len(params)), params...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var subs []Submission
+	for rows.Next() {
+		var s Submission
+		var submitter, identity *string
+		var hashes [][]byte
+		err = rows.Scan(&s.RequestID, &submitter, &identity,
+			&s.SubmittedAt, &s.Nodes, &hashes)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if submitter != nil {
+			s.Submitter = *submitter
+		}
+		if identity != nil {
+			s.SubmitterIdentity = *identity
+		}
+		s.SubmittedAt = s.SubmittedAt.UTC()
+		if len(hashes) != 0 {
+			s.Inserted = make([]merkletree.Hash, len(hashes))
+		}
+		for i := range hashes {
+			if len(hashes[i]) != len(s.Inserted[i]) {
+				return nil, errors.New(
+					"unexpected length of hash found in database")
+			}
+			copy(s.Inserted[i][:], hashes[i])
+		}
+		subs = append(subs, s)
+	}
+	return subs, errors.WithStack(rows.Err())
+}
+
+type memSubmissionLog struct {
+	mu   sync.RWMutex
+	subs []Submission
+}
+
+// NewMemorySubmissionLog creates a submission log that is kept in memory.
+func NewMemorySubmissionLog() SubmissionLog {
+	return &memSubmissionLog{}
+}
+
+func (m *memSubmissionLog) LogSubmission(_ context.Context,
+	s Submission) (Submission, error) {
+
+	s.SubmittedAt = publishTime()
+	m.mu.Lock()
+	m.subs = append(m.subs, s)
+	m.mu.Unlock()
+	return s, nil
+}
+
+func (m *memSubmissionLog) Submissions(_ context.Context,
+	f SubmissionFilter) ([]Submission, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var res []Submission
+	for i := len(m.subs) - 1; i >= 0 && len(res) < f.Limit; i-- {
+		if f.match(m.subs[i]) {
+			res = append(res, m.subs[i])
+		}
+	}
+	return res, nil
+}
+
+// boltSubmissionLog keeps submissions in a bucket with big-endian sequence
+// numbers as keys and JSON encoded submissions as values.
+type boltSubmissionLog struct {
+	db *bbolt.DB
+}
+
+// NewBoltSubmissionLog creates a submission log in an opened bbolt
+// database. Required buckets are created if they do not exist.
+func NewBoltSubmissionLog(db *bbolt.DB) (SubmissionLog, error) {
+	err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketNodeSubmission)
+		return errors.WithStack(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &boltSubmissionLog{db}, nil
+}
+
+func (b *boltSubmissionLog) LogSubmission(_ context.Context,
+	s Submission) (Submission, error) {
+
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		var err error
+		s, err = putSubmission(tx, s)
+		return err
+	})
+	return s, err
+}
+
+// putSubmission records s in tx, which may also save submitted nodes
+func putSubmission(tx *bbolt.Tx, s Submission) (Submission, error) {
+	s.SubmittedAt = publishTime()
+	value, err := json.Marshal(s)
+	if err != nil {
+		return s, errors.WithStack(err)
+	}
+	bkt := tx.Bucket(bucketNodeSubmission)
+	seq, err := bkt.NextSequence()
+	if err != nil {
+		return s, errors.WithStack(err)
+	}
+	var key [8]byte
+	binary.BigEndian.PutUint64(key[:], seq)
+	return s, errors.WithStack(bkt.Put(key[:], value))
+}
+
+func (b *boltSubmissionLog) Submissions(_ context.Context,
+	f SubmissionFilter) ([]Submission, error) {
+
+	var subs []Submission
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(bucketNodeSubmission).Cursor()
+		for k, v := c.Last(); k != nil && len(subs) < f.Limit; k, v = c.Prev() {
+			var s Submission
+			if err := json.Unmarshal(v, &s); err != nil {
+				return errors.WithStack(err)
+			}
+			s.SubmittedAt = s.SubmittedAt.UTC()
+			if len(s.Inserted) == 0 {
+				s.Inserted = nil
+			}
+			if f.match(s) {
+				subs = append(subs, s)
+			}
+		}
+		return nil
+	})
+	return subs, err
+}
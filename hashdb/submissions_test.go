@@ -0,0 +1,156 @@
+package hashdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/stretchr/testify/require"
+)
+
+func testSubmissionLog(t *testing.T, subs SubmissionLog) {
+	ctx := context.Background()
+
+	res, err := subs.Submissions(ctx, SubmissionFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Empty(t, res)
+
+	var logged []Submission
+	for _, s := range []Submission{
+		{RequestID: "r1", Submitter: "alice", Nodes: 2,
+			Inserted: []merkletree.Hash{{1}, {2}}},
+		{RequestID: "r2", SubmitterIdentity: "did:iden3:x1", Nodes: 3,
+			Inserted: []merkletree.Hash{{3}}},
+		{RequestID: "r3", Submitter: "alice", Nodes: 1},
+	} {
+		s2, err := subs.LogSubmission(ctx, s)
+		require.NoError(t, err)
+		require.False(t, s2.SubmittedAt.IsZero())
+		s.SubmittedAt = s2.SubmittedAt
+		require.Equal(t, s, s2)
+		logged = append(logged, s2)
+	}
+
+	res, err = subs.Submissions(ctx, SubmissionFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Equal(t, []Submission{logged[2], logged[1], logged[0]}, res)
+
+	res, err = subs.Submissions(ctx, SubmissionFilter{Limit: 1})
+	require.NoError(t, err)
+	require.Equal(t, []Submission{logged[2]}, res)
+
+	res, err = subs.Submissions(ctx,
+		SubmissionFilter{Submitter: "alice", Limit: 10})
+	require.NoError(t, err)
+	require.Equal(t, []Submission{logged[2], logged[0]}, res)
+
+	res, err = subs.Submissions(ctx,
+		SubmissionFilter{SubmitterIdentity: "did:iden3:x1", Limit: 10})
+	require.NoError(t, err)
+	require.Equal(t, []Submission{logged[1]}, res)
+
+	res, err = subs.Submissions(ctx,
+		SubmissionFilter{Hash: &merkletree.Hash{2}, Limit: 10})
+	require.NoError(t, err)
+	require.Equal(t, []Submission{logged[0]}, res)
+
+	res, err = subs.Submissions(ctx,
+		SubmissionFilter{Hash: &merkletree.Hash{4}, Limit: 10})
+	require.NoError(t, err)
+	require.Empty(t, res)
+
+	res, err = subs.Submissions(ctx, SubmissionFilter{
+		Since: logged[0].SubmittedAt.Add(-time.Hour),
+		Until: logged[0].SubmittedAt.Add(time.Hour),
+		Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, res, 3)
+
+	res, err = subs.Submissions(ctx, SubmissionFilter{
+		Until: logged[0].SubmittedAt, Limit: 10})
+	require.NoError(t, err)
+	require.Empty(t, res)
+}
+
+func TestMemorySubmissionLog(t *testing.T) {
+	testSubmissionLog(t, NewMemorySubmissionLog())
+}
+
+func TestBoltSubmissionLog(t *testing.T) {
+	subs, err := NewBoltSubmissionLog(newBoltDB(t))
+	require.NoError(t, err)
+	testSubmissionLog(t, subs)
+}
+
+func TestPgSubmissionLog(t *testing.T) {
+	testSubmissionLog(t, NewSubmissionLog(dbtest.WithEmpty(t)))
+}
+
+type failingSubmissionLog struct {
+	SubmissionLog
+}
+
+func (failingSubmissionLog) LogSubmission(context.Context,
+	Submission) (Submission, error) {
+
+	return Submission{}, errors.New("log is not available")
+}
+
+// testSaveNodesSubmissionLog checks that storage logs submissions in subs
+// together with nodes
+func testSaveNodesSubmissionLog(t *testing.T, storage Storage,
+	subs SubmissionLog) {
+
+	ctx := WithSubmitter(context.Background(), "alice")
+	n1 := nodeOf(t, merkletree.Hash{1}, merkletree.Hash{2})
+	n2 := nodeOf(t, merkletree.Hash{3}, merkletree.Hash{4})
+
+	// nothing is saved if the submission can't be logged
+	_, err := storage.SaveNodes(
+		WithSubmissionLog(ctx, failingSubmissionLog{}, "r1"),
+		[]Node{n1, n2})
+	require.EqualError(t, err,
+		"failed to log submission: log is not available")
+	_, err = storage.ByHash(ctx, n1.Hash)
+	require.ErrorIs(t, err, ErrDoesNotExists)
+
+	// so a retried submission is logged with the nodes it inserts
+	_, err = storage.SaveNodes(WithSubmissionLog(ctx, subs, "r1"),
+		[]Node{n1, n2})
+	require.NoError(t, err)
+	_, err = storage.SaveNodes(WithSubmissionLog(ctx, subs, "r2"),
+		[]Node{n1})
+	require.NoError(t, err)
+	// nodes saved without a log are not recorded
+	_, err = storage.SaveNodes(ctx, []Node{n1})
+	require.NoError(t, err)
+
+	res, err := subs.Submissions(ctx, SubmissionFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	require.Equal(t, Submission{RequestID: "r2", Submitter: "alice",
+		SubmittedAt: res[0].SubmittedAt, Nodes: 1}, res[0])
+	require.Equal(t, Submission{RequestID: "r1", Submitter: "alice",
+		SubmittedAt: res[1].SubmittedAt, Nodes: 2,
+		Inserted: []merkletree.Hash{n1.Hash, n2.Hash}}, res[1])
+}
+
+func TestMemoryStorage_SubmissionLog(t *testing.T) {
+	testSaveNodesSubmissionLog(t, NewMemory(), NewMemorySubmissionLog())
+}
+
+func TestBoltStorage_SubmissionLog(t *testing.T) {
+	db := newBoltDB(t)
+	storage, err := NewBolt(db)
+	require.NoError(t, err)
+	subs, err := NewBoltSubmissionLog(db)
+	require.NoError(t, err)
+	testSaveNodesSubmissionLog(t, storage, subs)
+}
+
+func TestPgStorage_SubmissionLog(t *testing.T) {
+	db := dbtest.WithEmpty(t)
+	testSaveNodesSubmissionLog(t, New(db), NewSubmissionLog(db))
+}
@@ -0,0 +1,46 @@
+package hashdb
+
+import "context"
+
+type submitterCtxKey struct{}
+
+// WithSubmitter returns a context that attributes nodes saved with it to
+// submitter, e.g. the name of an API key. Storages that keep attribution
+// record the submitter of the first save of a node.
+func WithSubmitter(ctx context.Context, submitter string) context.Context {
+	return context.WithValue(ctx, submitterCtxKey{}, submitter)
+}
+
+// SubmitterFrom returns the submitter set with WithSubmitter or an empty
+// string.
+func SubmitterFrom(ctx context.Context) string {
+	submitter, _ := ctx.Value(submitterCtxKey{}).(string)
+	return submitter
+}
+
+type submitterIdentityCtxKey struct{}
+
+// WithSubmitterIdentity returns a context that attributes nodes saved with
+// it to the iden3 identity that signed them.
+func WithSubmitterIdentity(ctx context.Context,
+	identity string) context.Context {
+
+	return context.WithValue(ctx, submitterIdentityCtxKey{}, identity)
+}
+
+// SubmitterIdentityFrom returns the identity set with WithSubmitterIdentity
+// or an empty string.
+func SubmitterIdentityFrom(ctx context.Context) string {
+	identity, _ := ctx.Value(submitterIdentityCtxKey{}).(string)
+	return identity
+}
+
+// submitter is who saves nodes, see WithSubmitter and WithSubmitterIdentity
+type submitter struct {
+	name     string
+	identity string
+}
+
+func submitterFrom(ctx context.Context) submitter {
+	return submitter{SubmitterFrom(ctx), SubmitterIdentityFrom(ctx)}
+}
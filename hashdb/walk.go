@@ -0,0 +1,67 @@
+package hashdb
+
+import (
+	"context"
+
+	"github.com/iden3/go-merkletree-sql"
+)
+
+// number of nodes requested from storage at once by WalkTrees
+const walkBatchSize = 1000
+
+// WalkTrees calls fn for every node reachable from roots. Children of middle
+// nodes and tree roots of identity state nodes are followed. Each node is
+// visited once, the order of visiting is not defined. Hashes of referenced
+// nodes missing from storage are returned.
+func WalkTrees(ctx context.Context, storage nodesBatchGetter,
+	roots []merkletree.Hash, fn func(Node) error) ([]merkletree.Hash, error) {
+
+	visited := make(map[merkletree.Hash]struct{})
+	var queue []merkletree.Hash
+	enqueue := func(h merkletree.Hash) {
+		if h == merkletree.HashZero {
+			return
+		}
+		if _, ok := visited[h]; ok {
+			return
+		}
+		visited[h] = struct{}{}
+		queue = append(queue, h)
+	}
+	for _, r := range roots {
+		enqueue(r)
+	}
+
+	var missing []merkletree.Hash
+	for len(queue) != 0 {
+		batch := queue
+		if len(batch) > walkBatchSize {
+			batch = batch[:walkBatchSize]
+		}
+		queue = queue[len(batch):]
+
+		nodes, err := storage.ByHashes(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		found := make(map[merkletree.Hash]struct{}, len(nodes))
+		for i := range nodes {
+			found[nodes[i].Hash] = struct{}{}
+			if err = fn(nodes[i]); err != nil {
+				return nil, err
+			}
+			switch nodes[i].Type() {
+			case NodeTypeMiddle, NodeTypeState:
+				for _, c := range nodes[i].Children {
+					enqueue(c)
+				}
+			}
+		}
+		for _, h := range batch {
+			if _, ok := found[h]; !ok {
+				missing = append(missing, h)
+			}
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,49 @@
+package hashdb
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/go-merkletree-sql/db/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalkTrees(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 40)
+	require.NoError(t, err)
+	for _, k := range []int64{1, 3, 5, 7, 10} {
+		err = mt.Add(ctx, big.NewInt(k), big.NewInt(0))
+		require.NoError(t, err)
+	}
+	treeNodes := treeNodes(t, mt)
+	state := nodeOf(t, *mt.Root(), *mt.Root(), merkletree.HashZero)
+	unrelated := nodeOf(t, hashFromIntString(t, "2"),
+		hashFromIntString(t, "3"), hashOne)
+
+	storage := NewMemory()
+	_, err = storage.SaveNodes(ctx,
+		append([]Node{state, unrelated}, treeNodes...))
+	require.NoError(t, err)
+
+	walk := func(roots ...merkletree.Hash) ([]Node, []merkletree.Hash) {
+		var nodes []Node
+		missing, err := WalkTrees(ctx, storage, roots, func(n Node) error {
+			nodes = append(nodes, n)
+			return nil
+		})
+		require.NoError(t, err)
+		return nodes, missing
+	}
+
+	nodes, missing := walk(state.Hash, *mt.Root(), merkletree.HashZero)
+	require.ElementsMatch(t, append([]Node{state}, treeNodes...), nodes)
+	require.Empty(t, missing)
+
+	missingHash := hashFromIntString(t, "5")
+	nodes, missing = walk(unrelated.Hash, missingHash)
+	require.Equal(t, []Node{unrelated}, nodes)
+	require.Equal(t, []merkletree.Hash{missingHash}, missing)
+}
@@ -0,0 +1,160 @@
+package http
+
+import (
+	"context"
+	stderr "errors"
+	"net/http"
+	"strings"
+
+	"github.com/iden3/go-iden3-crypto/babyjub"
+	"github.com/iden3/reverse-hash-service/auth"
+	"github.com/iden3/reverse-hash-service/hashdb"
+	"github.com/iden3/reverse-hash-service/log"
+	"go.uber.org/zap"
+)
+
+// headerAPIKey is an alternative to "Authorization: Bearer <key>"
+const headerAPIKey = "X-API-Key"
+
+type keyLookup interface {
+	KeyName(ctx context.Context, key string) (string, error)
+}
+
+// requireAPIKey rejects requests without a known API key. The key name is
+// put into the request context with hashdb.WithSubmitter, so saved nodes are
+// attributed to the key.
+func requireAPIKey(keys keyLookup) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			key := requestAPIKey(r)
+			if key == "" {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				jsonErr(ctx, w, http.StatusUnauthorized, "API key is required")
+				return
+			}
+
+			name, err := keys.KeyName(ctx, key)
+			if stderr.Is(err, auth.ErrUnknownKey) {
+				w.Header().Set("WWW-Authenticate",
+					`Bearer error="invalid_token"`)
+				jsonErr(ctx, w, http.StatusUnauthorized, "invalid API key")
+				return
+			} else if err != nil {
+				log.WithContext(ctx).Errorw(err.Error(), zap.Error(err))
+				jsonErr(ctx, w, http.StatusInternalServerError, err.Error())
+				return
+			}
+
+			ctx = hashdb.WithSubmitter(ctx, name)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+func requestAPIKey(r *http.Request) string {
+	if key := r.Header.Get(headerAPIKey); key != "" {
+		return key
+	}
+	const prefix = "bearer "
+	v := r.Header.Get("Authorization")
+	if len(v) > len(prefix) && strings.EqualFold(v[:len(prefix)], prefix) {
+		return strings.TrimSpace(v[len(prefix):])
+	}
+	return ""
+}
+
+// headers of submissions signed by an identity
+const (
+	headerIdentity  = "X-Identity"
+	headerSignature = "X-Signature"
+)
+
+type signingKeyLookup interface {
+	PublicKey(ctx context.Context,
+		identity string) (*babyjub.PublicKey, error)
+}
+
+// signedSubmission is an identity and its signature of submitted nodes that
+// is yet to be checked
+type signedSubmission struct {
+	identity  string
+	key       *babyjub.PublicKey
+	signature string
+}
+
+type signedSubmissionCtxKey struct{}
+
+// requireAPIKeyOrSignature accepts a submission signed by a known identity
+// instead of an API key. The signature covers the submitted nodes, so it is
+// checked by the handler with verifySignedNodes after nodes are read.
+// Requests without signature headers are passed to requireAPIKey, or to next
+// if keys is nil.
+func requireAPIKeyOrSignature(keys keyLookup,
+	signingKeys signingKeyLookup) func(next http.Handler) http.Handler {
+
+	return func(next http.Handler) http.Handler {
+		keyHandler := next
+		if keys != nil {
+			keyHandler = requireAPIKey(keys)(next)
+		}
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			signature := r.Header.Get(headerSignature)
+			if signature == "" {
+				keyHandler.ServeHTTP(w, r)
+				return
+			}
+			if signingKeys == nil {
+				jsonErr(ctx, w, http.StatusUnauthorized,
+					"signed submissions are not accepted")
+				return
+			}
+
+			identity := r.Header.Get(headerIdentity)
+			key, err := signingKeys.PublicKey(ctx, identity)
+			if stderr.Is(err, auth.ErrUnknownIdentity) {
+				jsonErr(ctx, w, http.StatusUnauthorized,
+					"unknown identity")
+				return
+			} else if err != nil {
+				log.WithContext(ctx).Errorw(err.Error(), zap.Error(err))
+				jsonErr(ctx, w, http.StatusInternalServerError, err.Error())
+				return
+			}
+
+			ctx = context.WithValue(ctx, signedSubmissionCtxKey{},
+				signedSubmission{identity, key, signature})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// verifySignedNodes checks the signature of nodes if the request is signed.
+// The returned request is attributed to the signing identity and counted
+// against its rate limits. If the signature does not match or the identity
+// is over its limit, an error is written to w and nil is returned.
+func verifySignedNodes(w http.ResponseWriter, r *http.Request,
+	nodes []hashdb.Node) *http.Request {
+
+	ctx := r.Context()
+	s, ok := ctx.Value(signedSubmissionCtxKey{}).(signedSubmission)
+	if !ok {
+		return r
+	}
+	err := auth.VerifyNodes(s.key, nodes, s.signature)
+	if stderr.Is(err, auth.ErrInvalidSignature) {
+		jsonErr(ctx, w, http.StatusUnauthorized, "invalid signature")
+		return nil
+	} else if err != nil {
+		log.WithContext(ctx).Errorw(err.Error(), zap.Error(err))
+		jsonErr(ctx, w, http.StatusInternalServerError, err.Error())
+		return nil
+	}
+	if !chargeIdentity(w, r, s.identity) {
+		return nil
+	}
+	return r.WithContext(hashdb.WithSubmitterIdentity(ctx, s.identity))
+}
@@ -0,0 +1,151 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iden3/go-iden3-crypto/babyjub"
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/reverse-hash-service/auth"
+	"github.com/iden3/reverse-hash-service/hashdb"
+	"github.com/stretchr/testify/require"
+)
+
+// submitterStorage remembers the submitter and the submitter identity of the
+// last SaveNodes call
+type submitterStorage struct {
+	hashdb.Storage
+	submitter string
+	identity  string
+}
+
+func (s *submitterStorage) SaveNodes(ctx context.Context,
+	nodes []hashdb.Node) ([]merkletree.Hash, error) {
+
+	s.submitter = hashdb.SubmitterFrom(ctx)
+	s.identity = hashdb.SubmitterIdentityFrom(ctx)
+	return s.Storage.SaveNodes(ctx, nodes)
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	keys, err := auth.ParseKeys("alice:secret1,bob:secret2")
+	require.NoError(t, err)
+	storage := &submitterStorage{Storage: hashdb.NewMemory()}
+	ts := httptest.NewServer(Handler(storage, WithAPIKeys(keys)))
+	defer ts.Close()
+
+	const node = "[" + testNode + "]"
+	do := func(method, path string, headers map[string]string,
+		body string) (int, string) {
+
+		resp, respBody := doRequest(t, ts, method, path, headers, body)
+		return resp.StatusCode, respBody
+	}
+
+	code, body := do(http.MethodPost, "/node", nil, node)
+	require.Equal(t, http.StatusUnauthorized, code)
+	require.JSONEq(t, `{"status":"error","error":"API key is required"}`,
+		body)
+
+	code, body = do(http.MethodPost, "/nodes/stream",
+		map[string]string{"Authorization": "Bearer secret3"}, node)
+	require.Equal(t, http.StatusUnauthorized, code)
+	require.JSONEq(t, `{"status":"error","error":"invalid API key"}`, body)
+
+	code, _ = do(http.MethodPost, "/node",
+		map[string]string{"Authorization": "Bearer secret1"}, node)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "alice", storage.submitter)
+
+	code, _ = do(http.MethodPost, "/node",
+		map[string]string{"X-API-Key": "secret2"}, node)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "bob", storage.submitter)
+
+	// read routes are public
+	code, _ = do(http.MethodGet, "/node/"+testNodeHash, nil, "")
+	require.Equal(t, http.StatusOK, code)
+	code, _ = do(http.MethodPost, "/nodes/query", nil,
+		`{"hashes":["`+testNodeHash+`"]}`)
+	require.Equal(t, http.StatusOK, code)
+}
+
+func TestRequireAPIKeyOrSignature(t *testing.T) {
+	keys, err := auth.ParseKeys("alice:secret1")
+	require.NoError(t, err)
+	const identity = "did:iden3:polygon:mumbai:x1"
+	privKey := babyjub.NewRandPrivKey()
+	signingKeys, err := auth.ParseSigningKeys(
+		identity + ":" + privKey.Public().Compress().String())
+	require.NoError(t, err)
+
+	storage := &submitterStorage{Storage: hashdb.NewMemory()}
+	ts := httptest.NewServer(Handler(storage, WithAPIKeys(keys),
+		WithSigningKeys(signingKeys)))
+	defer ts.Close()
+
+	sig := signNode(t, privKey, testNodeHash)
+	otherSig := signNode(t, babyjub.NewRandPrivKey(), testNodeHash)
+
+	post := func(headers map[string]string) (int, string) {
+		resp, body := doRequest(t, ts, http.MethodPost, "/node", headers,
+			"["+testNode+"]")
+		return resp.StatusCode, body
+	}
+
+	code, body := post(map[string]string{
+		"X-Identity": "did:iden3:unknown", "X-Signature": sig})
+	require.Equal(t, http.StatusUnauthorized, code)
+	require.JSONEq(t, `{"status":"error","error":"unknown identity"}`, body)
+
+	code, body = post(map[string]string{
+		"X-Identity": identity, "X-Signature": otherSig})
+	require.Equal(t, http.StatusUnauthorized, code)
+	require.JSONEq(t, `{"status":"error","error":"invalid signature"}`, body)
+
+	code, _ = post(map[string]string{
+		"X-Identity": identity, "X-Signature": sig})
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, identity, storage.identity)
+	require.Equal(t, "", storage.submitter)
+
+	// API keys are still accepted
+	code, _ = post(map[string]string{"X-API-Key": "secret1"})
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "alice", storage.submitter)
+	require.Equal(t, "", storage.identity)
+}
+
+func TestRequireAPIKeyOrSignature_SignaturesOnly(t *testing.T) {
+	const identity = "did:iden3:polygon:mumbai:x1"
+	privKey := babyjub.NewRandPrivKey()
+	signingKeys, err := auth.ParseSigningKeys(
+		identity + ":" + privKey.Public().Compress().String())
+	require.NoError(t, err)
+	ts := httptest.NewServer(Handler(hashdb.NewMemory(),
+		WithSigningKeys(signingKeys),
+		WithStateRegistry(hashdb.NewMemoryStateRegistry())))
+	defer ts.Close()
+
+	const node = "[" + testNode + "]"
+	post := func(path string, headers map[string]string,
+		body string) int {
+
+		resp, _ := doRequest(t, ts, http.MethodPost, path, headers, body)
+		return resp.StatusCode
+	}
+
+	// every write route requires authentication
+	require.Equal(t, http.StatusUnauthorized, post("/node", nil, node))
+	require.Equal(t, http.StatusUnauthorized,
+		post("/nodes/stream", nil, testNode))
+	require.Equal(t, http.StatusUnauthorized,
+		post("/identity/"+identity+"/state", nil,
+			`{"state":"`+testNodeHash+`"}`))
+
+	require.Equal(t, http.StatusOK, post("/node",
+		map[string]string{"X-Identity": identity,
+			"X-Signature": signNode(t, privKey, testNodeHash)}, node))
+}
@@ -0,0 +1,50 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/iden3/go-iden3-crypto/babyjub"
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/reverse-hash-service/auth"
+	"github.com/iden3/reverse-hash-service/hashdb"
+	"github.com/stretchr/testify/require"
+)
+
+// a valid middle node and its leaf child submitted in tests
+const (
+	testNodeHash = "2c32381aebce52c0c5c5a1fb92e726f66d977b58a1c8a0c14bb31ef968187325"
+	testNode     = `{"hash":"` + testNodeHash + `","children":["658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e","e809a4ed2cf98922910e456f1e56862bb958777f5ff0ea6799360113257f220f"]}`
+	testLeaf     = `{"hash":"658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e","children":["037c4d7bbb0407b8000000000000000000000000000000000000000000000000","0000000000000000000000000000000000000000000000000000000000000000","0100000000000000000000000000000000000000000000000000000000000000"]}`
+)
+
+// doRequest sends a request with headers to ts and returns the response with
+// its body read
+func doRequest(t testing.TB, ts *httptest.Server, method, path string,
+	headers map[string]string, body string) (*http.Response, string) {
+
+	req, err := http.NewRequest(method, ts.URL+path,
+		strings.NewReader(body))
+	require.NoError(t, err)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	respBody, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return resp, string(respBody)
+}
+
+// signNode returns a signature of submission of the node with hash
+func signNode(t testing.TB, key babyjub.PrivateKey, hash string) string {
+	h, err := merkletree.NewHashFromHex(hash)
+	require.NoError(t, err)
+	m, err := auth.NodesMessage([]hashdb.Node{{Hash: *h}})
+	require.NoError(t, err)
+	return key.SignPoseidon(m).Compress().String()
+}
@@ -1,24 +1,57 @@
 package http
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	stderr "errors"
+	"fmt"
+	"math/big"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/reverse-hash-service/auth"
 	"github.com/iden3/reverse-hash-service/hashdb"
 	"github.com/iden3/reverse-hash-service/log"
+	"github.com/iden3/reverse-hash-service/metrics"
+	"github.com/iden3/reverse-hash-service/ratelimit"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
 const (
 	paramHash = "hash"
+	paramRoot = "root"
+	paramKey  = "key"
+
+	paramState    = "state"
+	paramRevNonce = "revNonce"
+
+	paramIdentity = "identity"
+)
+
+// query parameters
+const (
+	// report children of submitted middle nodes missing from storage
+	queryCheckRefs = "check_refs"
+	// add metadata to the node returned by /node/{hash}
+	queryMeta = "meta"
+	// maximum number of states returned by /identity/{id}/states or
+	// submissions returned by /admin/submissions
+	queryLimit = "limit"
+	// filters of /admin/submissions, hash filter is named after paramHash
+	querySubmitter = "submitter"
+	queryIdentity  = "identity"
+	querySince     = "since"
+	queryUntil     = "until"
 )
 
 const (
@@ -27,6 +60,9 @@ const (
 	statusNotFound = "not found"
 )
 
+// set max-age to a year
+const cacheControlImmutable = "max-age=31536000, immutable, public"
+
 type Srv interface {
 	Run() error
 	Close(context.Context) error
@@ -53,27 +89,195 @@ func (s *srv) Close(ctx context.Context) error {
 type nodesStorage interface {
 	nodesSubmitter
 	nodesGetter
+	nodesBatchGetter
+	readinessChecker
+}
+
+// Option enables optional features of the RHS router
+type Option func(*options)
+
+type options struct {
+	states         hashdb.StateRegistry
+	nodeMeta       hashdb.NodeMetaGetter
+	submissions    hashdb.SubmissionLog
+	keys           auth.Keys
+	adminKeys      auth.Keys
+	signingKeys    auth.SigningKeys
+	keyIdentities  auth.KeyIdentities
+	allowedOrigins []string
+	rateLimits     RateLimits
+	proxyHeaders   bool
+}
+
+// WithStateRegistry enables publishing and querying of identity states
+func WithStateRegistry(states hashdb.StateRegistry) Option {
+	return func(o *options) {
+		o.states = states
+	}
+}
+
+// WithNodeMeta enables GET /node/{hash}?meta=1 that returns the node with
+// its metadata from meta. Pass the underlying storage here, not a decorator
+// like cache.
+func WithNodeMeta(meta hashdb.NodeMetaGetter) Option {
+	return func(o *options) {
+		o.nodeMeta = meta
+	}
+}
+
+// WithSubmissionLog records successful POST /node requests in subs
+func WithSubmissionLog(subs hashdb.SubmissionLog) Option {
+	return func(o *options) {
+		o.submissions = subs
+	}
+}
+
+// WithAdminKeys enables admin routes that require one of given API keys.
+// Admin routes are disabled by default.
+func WithAdminKeys(keys auth.Keys) Option {
+	return func(o *options) {
+		o.adminKeys = keys
+	}
+}
+
+// WithAPIKeys requires an API key on routes that write data. Read routes
+// stay public.
+func WithAPIKeys(keys auth.Keys) Option {
+	return func(o *options) {
+		o.keys = keys
+	}
+}
+
+// WithSigningKeys accepts POST /node requests signed by identities with
+// given keys instead of API keys. Nodes are attributed to the identity.
+func WithSigningKeys(keys auth.SigningKeys) Option {
+	return func(o *options) {
+		o.signingKeys = keys
+	}
+}
+
+// WithKeyIdentities allows API keys to publish states of identities. States
+// can also be published with requests signed by the identity, see
+// WithSigningKeys.
+func WithKeyIdentities(ki auth.KeyIdentities) Option {
+	return func(o *options) {
+		o.keyIdentities = ki
+	}
+}
+
+// WithAllowedOrigins sets origins allowed by CORS, all origins are allowed
+// by default
+func WithAllowedOrigins(origins []string) Option {
+	return func(o *options) {
+		o.allowedOrigins = origins
+	}
+}
+
+// WithRateLimits limits rates of requests and submitted nodes per client
+func WithRateLimits(limits RateLimits) Option {
+	return func(o *options) {
+		o.rateLimits = limits
+	}
+}
+
+// WithProxyHeaders takes client IP addresses from X-Forwarded-For and
+// X-Real-IP headers. Use it only behind a proxy that sets them.
+func WithProxyHeaders() Option {
+	return func(o *options) {
+		o.proxyHeaders = true
+	}
 }
 
-func New(listenAddr string, storage nodesStorage) Srv {
+func New(listenAddr string, storage nodesStorage, opts ...Option) Srv {
 	var s srv
-	s.s = &http.Server{Addr: listenAddr, Handler: setupRouter(storage)}
+	s.s = &http.Server{Addr: listenAddr,
+		Handler: setupRouter(storage, opts...)}
 	return &s
 }
 
-func setupRouter(storage nodesStorage) *chi.Mux {
+// Handler returns the RHS router without starting a server. Use it to embed
+// RHS into another HTTP server or into tests, e.g. with hashdb.NewMemory().
+func Handler(storage nodesStorage, opts ...Option) http.Handler {
+	return setupRouter(storage, opts...)
+}
+
+func setupRouter(storage nodesStorage, opts ...Option) *chi.Mux {
+	o := options{allowedOrigins: []string{"*"}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	limiters := newLimiters(o.rateLimits)
+
+	// With any authentication configured, every write route requires a valid
+	// API key or signature. Without API keys configured no key is valid.
+	keys := o.keys
+	if keys == nil && o.signingKeys != nil {
+		keys = auth.Chain()
+	}
+
 	r := chi.NewRouter()
+	if o.proxyHeaders {
+		r.Use(middleware.RealIP)
+	}
 	r.Use(middleware.RequestID)
 	r.Use(Logger(log.Logger, ""))
+	r.Use(metrics.Middleware)
+	allowedHeaders := []string{"Accept", "Authorization", "Content-Type",
+		"X-CSRF-Token", headerAPIKey, headerIdentity, headerSignature}
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins: []string{"*"},
+		AllowedOrigins: o.allowedOrigins,
 		AllowedMethods: []string{"GET", "POST", "OPTIONS"},
-		AllowedHeaders: []string{"Accept", "Content-Type", "X-CSRF-Token"},
+		AllowedHeaders: allowedHeaders,
 		MaxAge:         300,
 	}))
-	r.HandleFunc("/ping", getPingHandler()) // Liveness probe
-	r.Get("/node/{"+paramHash+"}", getNodeHandler(storage))
-	r.Post("/node", getNodeSubmitHandler(storage))
+	r.HandleFunc("/ping", getPingHandler())          // Liveness probe
+	r.HandleFunc("/ready", getReadyHandler(storage)) // Readiness probe
+	r.Handle("/metrics", metrics.Handler())
+
+	// routes that read data
+	r.Group(func(r chi.Router) {
+		r.Use(limitRequests(limiters.reads))
+		r.Get("/node/{"+paramHash+"}", getNodeHandler(storage, o.nodeMeta))
+		r.Post("/nodes/query", getNodesQueryHandler(storage))
+		r.Get("/proof/{"+paramRoot+"}/{"+paramKey+"}",
+			getProofHandler(storage))
+		r.Get("/revocation/{"+paramState+"}/{"+paramRevNonce+"}",
+			getRevocationHandler(storage))
+		if o.states != nil {
+			r.Get("/identity/{"+paramIdentity+"}/state/latest",
+				getLatestStateHandler(o.states))
+			r.Get("/identity/{"+paramIdentity+"}/states",
+				getStatesHandler(o.states))
+		}
+	})
+
+	// routes that write data
+	r.With(requireAPIKeyOrSignature(keys, o.signingKeys),
+		limitRequests(limiters.writes)).
+		Post("/node", getNodeSubmitHandler(storage, limiters.nodes,
+			o.submissions))
+	r.Group(func(r chi.Router) {
+		if keys != nil {
+			r.Use(requireAPIKey(keys))
+		}
+		r.Use(limitRequests(limiters.writes))
+		r.Post("/nodes/stream",
+			getNodesStreamHandler(storage, limiters.nodes,
+				o.submissions))
+	})
+	if o.states != nil {
+		r.With(requireAPIKeyOrSignature(keys, o.signingKeys),
+			limitRequests(limiters.writes)).
+			Post("/identity/{"+paramIdentity+"}/state",
+				getStatePublishHandler(o.states, storage,
+					o.keyIdentities))
+	}
+
+	if o.adminKeys != nil && o.submissions != nil {
+		r.With(requireAPIKey(o.adminKeys)).
+			Get("/admin/submissions", getSubmissionsHandler(o.submissions))
+	}
 	return r
 }
 
@@ -84,16 +288,41 @@ func getPingHandler() http.HandlerFunc {
 	}
 }
 
+type readinessChecker interface {
+	Ready(ctx context.Context) error
+}
+
+const readyTimeout = 5 * time.Second
+
+func getReadyHandler(storage readinessChecker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		defer cancel()
+
+		err := storage.Ready(ctx)
+		if err != nil {
+			log.WithContext(ctx).Warnw("service is not ready", zap.Error(err))
+			jsonErr(ctx, w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+
+		jsonResp(ctx, w, http.StatusOK,
+			map[string]interface{}{keyStatus: statusOK})
+	}
+}
+
 type nodesGetter interface {
 	ByHash(ctx context.Context, hash merkletree.Hash) (hashdb.Node, error)
 }
 
-func getNodeHandler(storage nodesGetter) http.HandlerFunc {
+// getNodeHandler returns a node. With meta=true query parameter the node
+// is looked up in meta and returned with its metadata.
+func getNodeHandler(storage nodesGetter,
+	meta nodeMetaGetter) http.HandlerFunc {
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
-		var cacheControl = "max-age=31536000, immutable, public"
-
 		var nodeHash merkletree.Hash
 		err := unpackHash(&nodeHash, chi.URLParam(r, paramHash))
 		if err != nil {
@@ -101,13 +330,26 @@ func getNodeHandler(storage nodesGetter) http.HandlerFunc {
 			return
 		}
 
+		if v := r.URL.Query().Get(queryMeta); v != "" {
+			withMeta, err := strconv.ParseBool(v)
+			if err != nil {
+				jsonErr(ctx, w, http.StatusBadRequest,
+					fmt.Sprintf("%v value is not a boolean", queryMeta))
+				return
+			}
+			if withMeta {
+				getNodeWithMeta(w, r, meta, nodeHash)
+				return
+			}
+		}
+
 		if v := r.Header.Get("If-None-Match"); v != "" &&
 			v[0] == '"' && v[len(v)-1] == '"' &&
 			strings.EqualFold(
 				strings.ToLower(v[1:len(v)-1]),
 				strings.ToLower(nodeHash.Hex())) {
 
-			w.Header().Set("Cache-Control", cacheControl)
+			w.Header().Set("Cache-Control", cacheControlImmutable)
 			w.Header().Set("ETag", `"`+nodeHash.Hex()+`"`)
 			w.WriteHeader(http.StatusNotModified)
 			return
@@ -124,20 +366,240 @@ func getNodeHandler(storage nodesGetter) http.HandlerFunc {
 			return
 		}
 
-		// set max-age to a year
-		w.Header().Set("Cache-Control", cacheControl)
+		w.Header().Set("Cache-Control", cacheControlImmutable)
 		w.Header().Set("ETag", `"`+node.Hash.Hex()+`"`)
 		jsonResp(ctx, w, http.StatusOK, nodeResponse{node, statusOK})
 	}
 }
 
+type nodeMetaGetter interface {
+	ByHashWithMeta(ctx context.Context,
+		hash merkletree.Hash) (hashdb.Node, error)
+}
+
+// getNodeWithMeta writes the node with its metadata. Unlike the node alone,
+// metadata is not immutable, e.g. it changes if the node is collected by GC
+// and submitted again, so it is not cached.
+func getNodeWithMeta(w http.ResponseWriter, r *http.Request,
+	meta nodeMetaGetter, nodeHash merkletree.Hash) {
+
+	ctx := r.Context()
+	if meta == nil {
+		jsonErr(ctx, w, http.StatusNotImplemented,
+			"node metadata is not supported by storage")
+		return
+	}
+
+	node, err := meta.ByHashWithMeta(ctx, nodeHash)
+	if stderr.Is(err, hashdb.ErrDoesNotExists) {
+		jsonResp(ctx, w, http.StatusNotFound,
+			map[string]interface{}{keyStatus: statusNotFound})
+		return
+	} else if err != nil {
+		log.WithContext(ctx).Errorw(err.Error(), zap.Error(err))
+		jsonErr(ctx, w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	jsonResp(ctx, w, http.StatusOK, nodeResponse{node, statusOK})
+}
+
+type nodesBatchGetter interface {
+	ByHashes(ctx context.Context,
+		hashes []merkletree.Hash) ([]hashdb.Node, error)
+}
+
+// maximum number of hashes in one /nodes/query request
+const maxNodesQuerySize = 10000
+
+// getNodesQueryHandler returns nodes for the list of hashes. Nodes are
+// returned in the order of requested hashes. Hashes not found in storage are
+// listed in the "missing" field.
+func getNodesQueryHandler(storage nodesBatchGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		var req nodesQueryRequest
+		dec := json.NewDecoder(r.Body)
+		err := dec.Decode(&req)
+		if err != nil {
+			jsonErr(ctx, w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if len(req.Hashes) > maxNodesQuerySize {
+			jsonErr(ctx, w, http.StatusBadRequest,
+				fmt.Sprintf("too many hashes in request, maximum is %v",
+					maxNodesQuerySize))
+			return
+		}
+
+		nodes, err := storage.ByHashes(ctx, req.Hashes)
+		if err != nil {
+			log.WithContext(ctx).Errorw(err.Error(), zap.Error(err))
+			jsonErr(ctx, w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		nodesIdx := make(map[merkletree.Hash]hashdb.Node, len(nodes))
+		for _, n := range nodes {
+			nodesIdx[n.Hash] = n
+		}
+		resp := nodesQueryResponse{Status: statusOK}
+		seen := make(map[merkletree.Hash]struct{}, len(req.Hashes))
+		for _, h := range req.Hashes {
+			if _, ok := seen[h]; ok {
+				continue
+			}
+			seen[h] = struct{}{}
+
+			n, ok := nodesIdx[h]
+			if ok {
+				resp.Nodes = append(resp.Nodes, n)
+			} else {
+				resp.Missing = append(resp.Missing, h)
+			}
+		}
+
+		jsonResp(ctx, w, http.StatusOK, resp)
+	}
+}
+
+func getProofHandler(storage nodesGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var treeRoot merkletree.Hash
+		err := unpackHash(&treeRoot, chi.URLParam(r, paramRoot))
+		if err != nil {
+			jsonErr(ctx, w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var key merkletree.Hash
+		err = unpackHash(&key, chi.URLParam(r, paramKey))
+		if err != nil {
+			jsonErr(ctx, w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		proof, err := hashdb.GenerateProof(ctx, storage, treeRoot, key)
+		if err != nil {
+			proofErr(ctx, w, err)
+			return
+		}
+
+		// tree is immutable, so is the proof
+		w.Header().Set("Cache-Control", cacheControlImmutable)
+		jsonResp(ctx, w, http.StatusOK, proofResponse{proof, statusOK})
+	}
+}
+
+func proofErr(ctx context.Context, w http.ResponseWriter, err error) {
+	switch {
+	case stderr.Is(err, hashdb.ErrDoesNotExists):
+		jsonResp(ctx, w, http.StatusNotFound,
+			map[string]interface{}{keyStatus: statusNotFound})
+	case stderr.Is(err, hashdb.ErrUnexpectedNodeType):
+		jsonErr(ctx, w, http.StatusBadRequest, err.Error())
+	default:
+		log.WithContext(ctx).Errorw(err.Error(), zap.Error(err))
+		jsonErr(ctx, w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// getRevocationHandler returns a proof of existence or non-existence of the
+// revocation nonce in the revocation tree of the identity state.
+func getRevocationHandler(storage nodesGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var state merkletree.Hash
+		err := unpackHash(&state, chi.URLParam(r, paramState))
+		if err != nil {
+			jsonErr(ctx, w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		revNonce, err := strconv.ParseUint(
+			chi.URLParam(r, paramRevNonce), 10, 64)
+		if err != nil {
+			jsonErr(ctx, w, http.StatusBadRequest,
+				"revocation nonce is not a valid unsigned integer")
+			return
+		}
+
+		stateNode, err := storage.ByHash(ctx, state)
+		if stderr.Is(err, hashdb.ErrDoesNotExists) {
+			jsonResp(ctx, w, http.StatusNotFound,
+				map[string]interface{}{keyStatus: statusNotFound})
+			return
+		} else if err != nil {
+			log.WithContext(ctx).Errorw(err.Error(), zap.Error(err))
+			jsonErr(ctx, w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if stateNode.Type() != hashdb.NodeTypeState {
+			jsonErr(ctx, w, http.StatusBadRequest,
+				"hash is not an identity state")
+			return
+		}
+		ts := treeState{
+			State:          stateNode.Hash,
+			ClaimsRoot:     stateNode.Children[0],
+			RevocationRoot: stateNode.Children[1],
+			RootOfRoots:    stateNode.Children[2],
+		}
+
+		revNonceKey := merkletree.NewHashFromBigInt(
+			new(big.Int).SetUint64(revNonce))
+		proof, err := hashdb.GenerateProof(ctx, storage, ts.RevocationRoot,
+			*revNonceKey)
+		if err != nil {
+			proofErr(ctx, w, err)
+			return
+		}
+
+		w.Header().Set("Cache-Control", cacheControlImmutable)
+		jsonResp(ctx, w, http.StatusOK,
+			revocationResponse{proof, ts, statusOK})
+	}
+}
+
 type nodesSubmitter interface {
-	SaveNodes(ctx context.Context, nodes []hashdb.Node) error
+	SaveNodes(ctx context.Context,
+		nodes []hashdb.Node) ([]merkletree.Hash, error)
+}
+
+type nodesSubmitChecker interface {
+	nodesSubmitter
+	nodesBatchGetter
 }
 
-func getNodeSubmitHandler(storage nodesSubmitter) http.HandlerFunc {
+// getNodeSubmitHandler saves nodes. With check_refs=true query parameter
+// children of middle nodes found neither in request nor in storage are
+// reported in the "dangling" field after nodes are saved. Nodes are counted
+// against nodeQuota if it is not nil. Signed requests are verified before
+// nodes are saved, see requireAPIKeyOrSignature. Submissions are recorded in
+// subs together with nodes if it is not nil, see withSubmissionLog.
+func getNodeSubmitHandler(storage nodesSubmitChecker,
+	nodeQuota *ratelimit.Limiter, subs hashdb.SubmissionLog) http.HandlerFunc {
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
+
+		checkRefs := false
+		if v := r.URL.Query().Get(queryCheckRefs); v != "" {
+			var err error
+			checkRefs, err = strconv.ParseBool(v)
+			if err != nil {
+				jsonErr(ctx, w, http.StatusBadRequest,
+					fmt.Sprintf("%v value is not a boolean", queryCheckRefs))
+				return
+			}
+		}
+
 		var req nodeSubmitRequest
 		dec := json.NewDecoder(r.Body)
 		err := dec.Decode(&req)
@@ -146,16 +608,169 @@ func getNodeSubmitHandler(storage nodesSubmitter) http.HandlerFunc {
 			return
 		}
 
-		err = storage.SaveNodes(ctx, req)
-		if err != nil {
+		if r = verifySignedNodes(w, r, req); r == nil {
+			return
+		}
+		ctx = r.Context()
+		if !allowNodes(w, r, nodeQuota, len(req)) {
+			return
+		}
+
+		_, err = storage.SaveNodes(withSubmissionLog(ctx, subs), req)
+		var nodeErrs hashdb.NodeErrors
+		if stderr.As(err, &nodeErrs) {
+			jsonResp(ctx, w, http.StatusBadRequest,
+				invalidNodesResponse{nodeErrs, statusError})
+			return
+		} else if err != nil {
 			log.WithContext(ctx).Errorw(err.Error(), zap.Error(err))
 			// TODO hide real error from user and show predefined errors only
 			jsonErr(ctx, w, http.StatusInternalServerError, err.Error())
 			return
 		}
 
+		if !checkRefs {
+			jsonResp(ctx, w, http.StatusOK,
+				map[string]interface{}{keyStatus: statusOK})
+			return
+		}
+
+		dangling, err := hashdb.DanglingChildren(ctx, storage, req)
+		if err != nil {
+			log.WithContext(ctx).Errorw(err.Error(), zap.Error(err))
+			jsonErr(ctx, w, http.StatusInternalServerError, err.Error())
+			return
+		}
 		jsonResp(ctx, w, http.StatusOK,
-			map[string]interface{}{keyStatus: statusOK})
+			nodeSubmitCheckResponse{dangling, statusOK})
+	}
+}
+
+const (
+	// number of nodes saved to storage at once by /nodes/stream
+	streamChunkSize = 1000
+	// maximum length of one line in /nodes/stream request
+	streamMaxLineSize = 64 * 1024
+	// maximum number of line errors reported by /nodes/stream
+	streamMaxErrors = 100
+)
+
+// getNodesStreamHandler accepts newline-delimited JSON nodes. Nodes are
+// validated as they are read and saved in chunks of streamChunkSize, so the
+// request body is never loaded into memory as a whole. Invalid lines,
+// including nodes rejected by storage with hashdb.NodeErrors, are skipped and
+// reported in the response. Each chunk is saved in a separate
+// transaction, so if a storage error occurs, chunks saved before it stay in
+// storage. Nodes are counted against nodeQuota if it is not nil, chunks are
+// not larger than the whole quota then. When the quota is exceeded,
+// reading stops with 429 and chunks saved before stay in storage too. Every
+// chunk is recorded in subs together with its nodes if
+// subs is not nil.
+func getNodesStreamHandler(storage nodesSubmitter,
+	nodeQuota *ratelimit.Limiter, subs hashdb.SubmissionLog) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		saveCtx := withSubmissionLog(ctx, subs)
+		resp := nodesStreamResponse{Errors: []lineError{}, Status: statusOK}
+
+		chunkSize := streamChunkSize
+		if nodeQuota != nil && nodeQuota.Burst() < chunkSize {
+			chunkSize = nodeQuota.Burst()
+		}
+		chunk := make([]hashdb.Node, 0, chunkSize)
+		// line numbers of nodes in chunk
+		chunkLines := make([]int, 0, chunkSize)
+		saveChunk := func() error {
+			if len(chunk) == 0 {
+				return nil
+			}
+			inserted, err := storage.SaveNodes(saveCtx, chunk)
+			var nodeErrs hashdb.NodeErrors
+			if stderr.As(err, &nodeErrs) {
+				// report rejected nodes and save the rest of the chunk
+				rejected := make(map[int]struct{}, len(nodeErrs))
+				for _, e := range nodeErrs {
+					rejected[e.Index] = struct{}{}
+					resp.addLineError(chunkLines[e.Index], e.Err)
+				}
+				valid := chunk[:0]
+				for i := range chunk {
+					if _, ok := rejected[i]; !ok {
+						valid = append(valid, chunk[i])
+					}
+				}
+				chunk = valid
+				inserted, err = nil, nil
+				if len(chunk) != 0 {
+					inserted, err = storage.SaveNodes(saveCtx, chunk)
+				}
+			}
+			if err != nil {
+				return err
+			}
+			resp.Saved += len(chunk)
+			resp.Inserted += len(inserted)
+			chunk = chunk[:0]
+			chunkLines = chunkLines[:0]
+			return nil
+		}
+
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(nil, streamMaxLineSize)
+		lineNum := 0
+		for scanner.Scan() {
+			lineNum++
+			line := scanner.Bytes()
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			resp.Received++
+
+			var n hashdb.Node
+			err := json.Unmarshal(line, &n)
+			if err == nil {
+				err = n.Validate()
+			}
+			if err != nil {
+				resp.addLineError(lineNum, err)
+				continue
+			}
+
+			chunk = append(chunk, n)
+			chunkLines = append(chunkLines, lineNum)
+			if len(chunk) == chunkSize {
+				if !allowNodes(w, r, nodeQuota, len(chunk)) {
+					return
+				}
+				if err = saveChunk(); err != nil {
+					log.WithContext(ctx).Errorw(err.Error(), zap.Error(err))
+					jsonErr(ctx, w, http.StatusInternalServerError,
+						err.Error())
+					return
+				}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			jsonErr(ctx, w, http.StatusBadRequest,
+				fmt.Sprintf("error reading line #%v: %v", lineNum+1, err))
+			return
+		}
+
+		if !allowNodes(w, r, nodeQuota, len(chunk)) {
+			return
+		}
+		if err := saveChunk(); err != nil {
+			log.WithContext(ctx).Errorw(err.Error(), zap.Error(err))
+			jsonErr(ctx, w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		// nodes rejected by storage are reported after lines read later
+		sort.Slice(resp.Errors, func(i, j int) bool {
+			return resp.Errors[i].Line < resp.Errors[j].Line
+		})
+		jsonResp(ctx, w, http.StatusOK, resp)
 	}
 }
 
@@ -2,14 +2,18 @@ package http
 
 import (
 	"context"
+	"encoding/json"
 	stderr "errors"
 	"io"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/reverse-hash-service/auth"
 	"github.com/iden3/reverse-hash-service/hashdb"
 	go_test_pg "github.com/olomix/go-test-pg"
 	"github.com/pkg/errors"
@@ -25,9 +29,16 @@ var dbtest = go_test_pg.Pgpool{
 type nodesStorageMock struct {
 	nodes        map[merkletree.Hash]hashdb.Node
 	byHashErrors map[merkletree.Hash]error
+	readyErr     error
 }
 
-func (n *nodesStorageMock) SaveNodes(_ context.Context, _ []hashdb.Node) error {
+func (n *nodesStorageMock) Ready(_ context.Context) error {
+	return n.readyErr
+}
+
+func (n *nodesStorageMock) SaveNodes(_ context.Context,
+	_ []hashdb.Node) ([]merkletree.Hash, error) {
+
 	panic("implement me")
 }
 
@@ -47,6 +58,22 @@ func (n *nodesStorageMock) ByHash(_ context.Context,
 	return node, nil
 }
 
+func (n *nodesStorageMock) ByHashes(ctx context.Context,
+	hashes []merkletree.Hash) ([]hashdb.Node, error) {
+
+	var nodes []hashdb.Node
+	for _, h := range hashes {
+		node, err := n.ByHash(ctx, h)
+		if stderr.Is(err, hashdb.ErrDoesNotExists) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
 func TestGetNodeHandler(t *testing.T) {
 	node1 := mkNode(t,
 		"2c32381aebce52c0c5c5a1fb92e726f66d977b58a1c8a0c14bb31ef968187325",
@@ -90,7 +117,8 @@ func TestGetNodeHandler(t *testing.T) {
     "children":[
       "658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e",
       "e809a4ed2cf98922910e456f1e56862bb958777f5ff0ea6799360113257f220f"
-    ]
+    ],
+    "type":"middle"
   }
 }`,
 		},
@@ -106,7 +134,8 @@ func TestGetNodeHandler(t *testing.T) {
       "037c4d7bbb0407b8000000000000000000000000000000000000000000000000",
       "0000000000000000000000000000000000000000000000000000000000000000",
       "0100000000000000000000000000000000000000000000000000000000000000"
-    ]
+    ],
+    "type":"leaf"
   }
 }`,
 		},
@@ -138,6 +167,193 @@ func TestGetNodeHandler(t *testing.T) {
 	}
 }
 
+func TestGetNodeHandler_Meta(t *testing.T) {
+	keys, err := auth.ParseKeys("alice:secret1")
+	require.NoError(t, err)
+	storage := hashdb.NewMemory()
+	ts := httptest.NewServer(Handler(storage, WithAPIKeys(keys),
+		WithNodeMeta(storage.(hashdb.NodeMetaGetter))))
+	defer ts.Close()
+
+	resp, _ := doRequest(t, ts, http.MethodPost, "/node",
+		map[string]string{"X-API-Key": "secret1"}, "["+testNode+"]")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	get := func(path string) (*http.Response, string) {
+		return doRequest(t, ts, http.MethodGet, path, nil, "")
+	}
+
+	// the response without meta does not change
+	for _, path := range []string{"/node/" + testNodeHash,
+		"/node/" + testNodeHash + "?meta=0"} {
+		resp, body := get(path)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, cacheControlImmutable,
+			resp.Header.Get("Cache-Control"))
+		require.Equal(t, `{"node":{"children":["658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e","e809a4ed2cf98922910e456f1e56862bb958777f5ff0ea6799360113257f220f"],"hash":"`+testNodeHash+`","type":"middle"},"status":"OK"}`,
+			body)
+	}
+
+	resp, body := get("/node/" + testNodeHash + "?meta=1")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "no-cache", resp.Header.Get("Cache-Control"))
+	var nodeResp struct {
+		Node struct {
+			Hash string `json:"hash"`
+			Meta struct {
+				FirstSeen         time.Time `json:"first_seen"`
+				Submitter         string    `json:"submitter"`
+				SubmitterIdentity *string   `json:"submitter_identity"`
+			} `json:"meta"`
+		} `json:"node"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &nodeResp))
+	require.Equal(t, testNodeHash, nodeResp.Node.Hash)
+	require.WithinDuration(t, time.Now(), nodeResp.Node.Meta.FirstSeen,
+		time.Minute)
+	require.Equal(t, "alice", nodeResp.Node.Meta.Submitter)
+	require.Nil(t, nodeResp.Node.Meta.SubmitterIdentity)
+
+	resp, body = get("/node/" +
+		"00000000004ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e" +
+		"?meta=1")
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	require.JSONEq(t, `{"status":"not found"}`, body)
+
+	resp, body = get("/node/" + testNodeHash + "?meta=yes")
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.JSONEq(t,
+		`{"status":"error","error":"meta value is not a boolean"}`, body)
+
+	// storage without metadata
+	ts2 := httptest.NewServer(Handler(storage))
+	defer ts2.Close()
+	resp, _ = doRequest(t, ts2, http.MethodGet, "/node/"+testNodeHash+"?meta=1",
+		nil, "")
+	require.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+}
+
+func TestGetReadyHandler(t *testing.T) {
+	ng := nodesStorageMock{}
+	router := setupRouter(&ng)
+
+	req := httptest.NewRequest(http.MethodGet, "/ready", http.NoBody)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.JSONEq(t, `{"status":"OK"}`, rr.Body.String())
+
+	ng.readyErr = stderr.New("table mt_node does not exist")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	require.JSONEq(t,
+		`{"status":"error","error":"table mt_node does not exist"}`,
+		rr.Body.String())
+}
+
+func TestGetNodesQueryHandler(t *testing.T) {
+	node1 := mkNode(t,
+		"2c32381aebce52c0c5c5a1fb92e726f66d977b58a1c8a0c14bb31ef968187325",
+		[]string{
+			"658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e",
+			"e809a4ed2cf98922910e456f1e56862bb958777f5ff0ea6799360113257f220f",
+		})
+	node2 := mkNode(t,
+		"658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e",
+		[]string{
+			"037c4d7bbb0407b8000000000000000000000000000000000000000000000000",
+			"0000000000000000000000000000000000000000000000000000000000000000",
+			"0100000000000000000000000000000000000000000000000000000000000000",
+		})
+	ng := nodesStorageMock{
+		nodes: map[merkletree.Hash]hashdb.Node{
+			node1.Hash: node1,
+			node2.Hash: node2,
+		},
+		byHashErrors: map[merkletree.Hash]error{
+			hashFromHex(t,
+				"11111111114ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e"): stderr.New("some internal error"),
+		},
+	}
+	router := setupRouter(&ng)
+
+	testCases := []struct {
+		title    string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			title: "found and missing nodes",
+			body: `{"hashes":[
+  "658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e",
+  "00000000004ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e",
+  "2c32381aebce52c0c5c5a1fb92e726f66d977b58a1c8a0c14bb31ef968187325",
+  "658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e"
+]}`,
+			wantCode: http.StatusOK,
+			wantBody: `{
+  "status":"OK",
+  "nodes":[
+    {
+      "hash":"658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e",
+      "children":[
+        "037c4d7bbb0407b8000000000000000000000000000000000000000000000000",
+        "0000000000000000000000000000000000000000000000000000000000000000",
+        "0100000000000000000000000000000000000000000000000000000000000000"
+      ],
+      "type":"leaf"
+    },
+    {
+      "hash":"2c32381aebce52c0c5c5a1fb92e726f66d977b58a1c8a0c14bb31ef968187325",
+      "children":[
+        "658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e",
+        "e809a4ed2cf98922910e456f1e56862bb958777f5ff0ea6799360113257f220f"
+      ],
+      "type":"middle"
+    }
+  ],
+  "missing":[
+    "00000000004ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e"
+  ]
+}`,
+		},
+		{
+			title:    "empty request",
+			body:     `{"hashes":[]}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"status":"OK","nodes":[],"missing":[]}`,
+		},
+		{
+			title:    "incorrect hash",
+			body:     `{"hashes":["2c32"]}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"status":"error","error":"error parsing hash #1: length of hash should be 64"}`,
+		},
+		{
+			title:    "Internal error",
+			body:     `{"hashes":["11111111114ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e"]}`,
+			wantCode: http.StatusInternalServerError,
+			wantBody: `{"error":"some internal error","status":"error"}`,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.title, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/nodes/query",
+				strings.NewReader(tc.body))
+			require.NoError(t, err)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.wantCode, rr.Code, rr.Body.String())
+			require.JSONEq(t, tc.wantBody, rr.Body.String())
+		})
+	}
+}
+
 // The order of test cases is important. Do not run sub-tests in parallel.
 func TestGetNodeSubmitHandler(t *testing.T) {
 	storage := hashdb.New(dbtest.WithEmpty(t))
@@ -212,7 +428,8 @@ func TestGetNodeSubmitHandler(t *testing.T) {
     "children":[
       "658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e",
       "e809a4ed2cf98922910e456f1e56862bb958777f5ff0ea6799360113257f220f"
-    ]
+    ],
+    "type":"middle"
   }
 }`,
 			wantHdrs: [][2]string{
@@ -238,7 +455,8 @@ func TestGetNodeSubmitHandler(t *testing.T) {
       "037c4d7bbb0407b8000000000000000000000000000000000000000000000000",
       "0000000000000000000000000000000000000000000000000000000000000000",
       "0100000000000000000000000000000000000000000000000000000000000000"
-    ]
+    ],
+    "type":"leaf"
   }
 }`,
 			wantHdrs: [][2]string{
@@ -322,6 +540,34 @@ func TestGetNodeSubmitHandler(t *testing.T) {
 	}
 }
 
+func TestHandler_MemoryStorage(t *testing.T) {
+	ts := httptest.NewServer(Handler(hashdb.NewMemory()))
+	defer ts.Close()
+
+	nodeJSON := `{
+  "hash":"2c32381aebce52c0c5c5a1fb92e726f66d977b58a1c8a0c14bb31ef968187325",
+  "children":[
+    "658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e",
+    "e809a4ed2cf98922910e456f1e56862bb958777f5ff0ea6799360113257f220f"
+  ],
+  "type":"middle"
+}`
+	resp, err := http.Post(ts.URL+"/node", "application/json",
+		strings.NewReader("["+nodeJSON+"]"))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(ts.URL +
+		"/node/2c32381aebce52c0c5c5a1fb92e726f66d977b58a1c8a0c14bb31ef968187325")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.JSONEq(t, `{"status":"OK","node":`+nodeJSON+`}`, string(body))
+}
+
 func mkNode(t testing.TB, hash string, children []string) hashdb.Node {
 	var childrenH = make([]merkletree.Hash, len(children))
 	for i := range children {
@@ -332,3 +578,125 @@ func mkNode(t testing.TB, hash string, children []string) hashdb.Node {
 		Children: childrenH,
 	}
 }
+
+func TestGetNodesStreamHandler(t *testing.T) {
+	ts := httptest.NewServer(Handler(hashdb.NewMemory()))
+	defer ts.Close()
+
+	body := testNode + `
+
+` + testNode + `
+{"hash":"1111111111111111111111111111111111111111111111111111111111111111","children":["658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e","e809a4ed2cf98922910e456f1e56862bb958777f5ff0ea6799360113257f220f"]}
+not a json
+`
+	resp, respBody := doRequest(t, ts, http.MethodPost, "/nodes/stream",
+		nil, body)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.JSONEq(t, `{
+  "received": 4,
+  "saved": 2,
+  "inserted": 1,
+  "failed": 2,
+  "errors": [
+    {"line": 4, "error": "node hash is not correct"},
+    {"line": 5, "error": "invalid character 'o' in literal null (expecting 'u')"}
+  ],
+  "status": "OK"
+}`, respBody)
+
+	resp, _ = doRequest(t, ts, http.MethodGet, "/node/"+testNodeHash, nil,
+		"")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestStrictStorage(t *testing.T) {
+	ts := httptest.NewServer(Handler(hashdb.NewStrict(hashdb.NewMemory())))
+	defer ts.Close()
+
+	// valid hash of a node with a single child 1
+	oneChildHash, err := merkletree.HashElems(big.NewInt(1))
+	require.NoError(t, err)
+	badNode := `{"hash":"` + oneChildHash.Hex() + `","children":["0100000000000000000000000000000000000000000000000000000000000000"]}`
+
+	resp, respBody := doRequest(t, ts, http.MethodPost, "/node", nil,
+		"["+testNode+","+badNode+"]")
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.JSONEq(t, `{
+  "status": "error",
+  "error": "invalid nodes",
+  "errors": [
+    {
+      "index": 1,
+      "hash": "`+oneChildHash.Hex()+`",
+      "error": "1 children: node shape is not supported"
+    }
+  ]
+}`, respBody)
+
+	resp, respBody = doRequest(t, ts, http.MethodPost, "/nodes/stream", nil,
+		badNode+"\nnot a json\n"+testNode+"\n")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.JSONEq(t, `{
+  "received": 3,
+  "saved": 1,
+  "inserted": 1,
+  "failed": 2,
+  "errors": [
+    {"line": 1, "error": "1 children: node shape is not supported"},
+    {"line": 2, "error": "invalid character 'o' in literal null (expecting 'u')"}
+  ],
+  "status": "OK"
+}`, respBody)
+}
+
+func TestGetNodeSubmitHandler_CheckRefs(t *testing.T) {
+	ts := httptest.NewServer(Handler(hashdb.NewMemory()))
+	defer ts.Close()
+
+	post := func(query, body string) (int, string) {
+		resp, respBody := doRequest(t, ts, http.MethodPost, "/node"+query,
+			nil, body)
+		return resp.StatusCode, respBody
+	}
+
+	code, body := post("?check_refs=true", "["+testNode+"]")
+	require.Equal(t, http.StatusOK, code)
+	require.JSONEq(t, `{
+  "status": "OK",
+  "dangling": [
+    "658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e",
+    "e809a4ed2cf98922910e456f1e56862bb958777f5ff0ea6799360113257f220f"
+  ]
+}`, body)
+
+	// leaf is found in request
+	code, body = post("?check_refs=1", "["+testNode+","+testLeaf+"]")
+	require.Equal(t, http.StatusOK, code)
+	require.JSONEq(t, `{
+  "status": "OK",
+  "dangling": [
+    "e809a4ed2cf98922910e456f1e56862bb958777f5ff0ea6799360113257f220f"
+  ]
+}`, body)
+
+	// leaf is found in storage
+	code, body = post("?check_refs=1", "["+testNode+"]")
+	require.Equal(t, http.StatusOK, code)
+	require.JSONEq(t, `{
+  "status": "OK",
+  "dangling": [
+    "e809a4ed2cf98922910e456f1e56862bb958777f5ff0ea6799360113257f220f"
+  ]
+}`, body)
+
+	code, body = post("", "["+testNode+"]")
+	require.Equal(t, http.StatusOK, code)
+	require.JSONEq(t, `{"status": "OK"}`, body)
+
+	code, body = post("?check_refs=maybe", "["+testNode+"]")
+	require.Equal(t, http.StatusBadRequest, code)
+	require.JSONEq(t, `{
+  "status": "error",
+  "error": "check_refs value is not a boolean"
+}`, body)
+}
@@ -480,6 +480,13 @@ func saveIdenStateToRHS(t testing.TB, httpRouter http.Handler,
 
 func saveTreeToRHS(t testing.TB,
 	httpRouter http.Handler, merkleTree *merkletree.MerkleTree) {
+
+	submitNodesToRHS(t, httpRouter, treeToNodes(t, merkleTree))
+}
+
+func treeToNodes(t testing.TB,
+	merkleTree *merkletree.MerkleTree) nodeSubmitRequest {
+
 	ctx := context.Background()
 	var req nodeSubmitRequest
 	hashOne := merkletree.NewHashFromBigInt(big.NewInt(1))
@@ -506,8 +513,7 @@ func saveTreeToRHS(t testing.TB,
 		}
 	})
 	require.NoError(t, err)
-
-	submitNodesToRHS(t, httpRouter, req)
+	return req
 }
 
 func drawTree(t testing.TB, merkleTree *merkletree.MerkleTree) {
@@ -730,6 +736,153 @@ node [fontname=Monospace,fontsize=10,shape=box]
 	}
 }
 
+func TestGetProofHandler(t *testing.T) {
+	revNonces := []uint64{
+		5577006791947779410,
+		8674665223082153551,
+		8674665223082147919,
+		15352856648520921629,
+		13260572831089785859,
+		10667007354186551956,
+	}
+	merkleTree := buildTree(t, revNonces)
+	ng := nodesStorageMock{nodes: map[merkletree.Hash]hashdb.Node{}}
+	for _, n := range treeToNodes(t, merkleTree) {
+		ng.nodes[n.Hash] = n
+	}
+	ts := httptest.NewServer(setupRouter(&ng))
+	defer ts.Close()
+
+	getProof := func(t testing.TB, treeRoot, key merkletree.Hash) (int,
+		string) {
+
+		resp, err := http.Get(
+			ts.URL + "/proof/" + treeRoot.Hex() + "/" + key.Hex())
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var body bytes.Buffer
+		_, err = body.ReadFrom(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, body.String()
+	}
+
+	for _, revNonce := range append(revNonces, 5, 31) {
+		key := mkHashFromInt(revNonce)
+		wantProof, err := generateProof(ts.URL, *merkleTree.Root(), key)
+		require.NoError(t, err)
+		wantProofBytes, err := json.Marshal(wantProof)
+		require.NoError(t, err)
+
+		code, body := getProof(t, *merkleTree.Root(), key)
+		require.Equal(t, http.StatusOK, code, body)
+		require.JSONEq(t,
+			`{"status":"OK","proof":`+string(wantProofBytes)+`}`, body)
+	}
+
+	code, body := getProof(t,
+		mkHash("1234567812345678123456781234567812345678123456781234567812345678"),
+		mkHashFromInt(31))
+	require.Equal(t, http.StatusNotFound, code)
+	require.JSONEq(t, `{"status":"not found"}`, body)
+
+	resp, err := http.Get(ts.URL + "/proof/xyz/" + mkHashFromInt(31).Hex())
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestGetRevocationHandler(t *testing.T) {
+	revNonces := []uint64{
+		5577006791947779410,
+		8674665223082153551,
+		15352856648520921629,
+		10667007354186551956,
+	}
+	merkleTree := buildTree(t, revNonces)
+	revTreeRoot := *merkleTree.Root()
+	ng := nodesStorageMock{nodes: map[merkletree.Hash]hashdb.Node{}}
+	for _, n := range treeToNodes(t, merkleTree) {
+		ng.nodes[n.Hash] = n
+	}
+	claimsRoot := mkHashFromInt(100)
+	state, err := poseidon.Hash([]*big.Int{claimsRoot.BigInt(),
+		revTreeRoot.BigInt(), big.NewInt(0)})
+	require.NoError(t, err)
+	stateHash := *merkletree.NewHashFromBigInt(state)
+	ng.nodes[stateHash] = hashdb.Node{
+		Hash: stateHash,
+		Children: []merkletree.Hash{
+			claimsRoot, revTreeRoot, merkletree.HashZero},
+	}
+	ts := httptest.NewServer(setupRouter(&ng))
+	defer ts.Close()
+
+	getRevocation := func(t testing.TB, path string) (int, string) {
+		resp, err := http.Get(ts.URL + "/revocation/" + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var body bytes.Buffer
+		_, err = body.ReadFrom(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, body.String()
+	}
+
+	wantTreeState := fmt.Sprintf(`{
+  "state": "%v",
+  "claims_tree_root": "%v",
+  "revocation_tree_root": "%v",
+  "root_of_roots": "0000000000000000000000000000000000000000000000000000000000000000"
+}`, stateHash.Hex(), claimsRoot.Hex(), revTreeRoot.Hex())
+
+	for _, revNonce := range append(revNonces, 5, 31) {
+		wantProof, err := generateProof(ts.URL, revTreeRoot,
+			mkHashFromInt(revNonce))
+		require.NoError(t, err)
+		wantProofBytes, err := json.Marshal(wantProof)
+		require.NoError(t, err)
+
+		code, body := getRevocation(t,
+			fmt.Sprintf("%v/%v", stateHash.Hex(), revNonce))
+		require.Equal(t, http.StatusOK, code, body)
+		require.JSONEq(t, `{"status":"OK","proof":`+string(wantProofBytes)+
+			`,"tree_state":`+wantTreeState+`}`, body)
+	}
+
+	testCases := []struct {
+		title    string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			title:    "unknown state",
+			path:     mkHashFromInt(1).Hex() + "/5",
+			wantCode: http.StatusNotFound,
+			wantBody: `{"status":"not found"}`,
+		},
+		{
+			title:    "not a state node",
+			path:     revTreeRoot.Hex() + "/5",
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"status":"error","error":"hash is not an identity state"}`,
+		},
+		{
+			title:    "invalid nonce",
+			path:     stateHash.Hex() + "/-5",
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"status":"error","error":"revocation nonce is not a valid unsigned integer"}`,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.title, func(t *testing.T) {
+			code, body := getRevocation(t, tc.path)
+			require.Equal(t, tc.wantCode, code, body)
+			require.JSONEq(t, tc.wantBody, body)
+		})
+	}
+}
+
 func TestProof_Unmarshal(t *testing.T) {
 	testCases := []struct {
 		title string
@@ -0,0 +1,154 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/iden3/reverse-hash-service/hashdb"
+	"github.com/iden3/reverse-hash-service/ratelimit"
+)
+
+// RateLimits are limits per client. A client is identified by the name of
+// its API key on write routes that require keys, and by IP address
+// otherwise. Zero values disable limits.
+type RateLimits struct {
+	// requests per second to read routes
+	ReadsPerSecond int
+	// time window of write limits
+	Window time.Duration
+	// requests per Window to write routes
+	WritesPerWindow int
+	// nodes per Window submitted with POST /node and /nodes/stream
+	NodesPerWindow int
+}
+
+type limiters struct {
+	reads  *ratelimit.Limiter
+	writes *ratelimit.Limiter
+	nodes  *ratelimit.Limiter
+}
+
+func newLimiters(l RateLimits) limiters {
+	var ls limiters
+	if l.ReadsPerSecond > 0 {
+		ls.reads = ratelimit.New(l.ReadsPerSecond, time.Second)
+	}
+	if l.WritesPerWindow > 0 && l.Window > 0 {
+		ls.writes = ratelimit.New(l.WritesPerWindow, l.Window)
+	}
+	if l.NodesPerWindow > 0 && l.Window > 0 {
+		ls.nodes = ratelimit.New(l.NodesPerWindow, l.Window)
+	}
+	return ls
+}
+
+// clientKey identifies the client for rate limiting. Signed requests are
+// counted against the client IP address until the signature is checked, so
+// requests with forged signatures can't use up the quota of the identity,
+// see chargeIdentity.
+func clientKey(r *http.Request) string {
+	ctx := r.Context()
+	if identity := hashdb.SubmitterIdentityFrom(ctx); identity != "" {
+		return "identity:" + identity
+	}
+	if submitter := hashdb.SubmitterFrom(ctx); submitter != "" {
+		return "key:" + submitter
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// requestCharge is the limiter and the client key a signed request was
+// counted against by limitRequests
+type requestCharge struct {
+	l   *ratelimit.Limiter
+	key string
+}
+
+type requestChargeCtxKey struct{}
+
+// limitRequests rejects requests over the limit. With nil limiter it does
+// nothing.
+func limitRequests(l *ratelimit.Limiter) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if l == nil {
+			return next
+		}
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			key := clientKey(r)
+			ok, wait := l.Allow(key, 1)
+			if !ok {
+				rateLimitErr(ctx, w, wait, "rate limit exceeded")
+				return
+			}
+			_, signed := ctx.Value(signedSubmissionCtxKey{}).(signedSubmission)
+			if signed {
+				ctx = context.WithValue(ctx, requestChargeCtxKey{},
+					requestCharge{l, key})
+				r = r.WithContext(ctx)
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// chargeIdentity moves a signed request from the limit of the client IP
+// address to the limit of identity after the signature is checked. If the
+// identity is over the limit, 429 is written to w and false is returned.
+func chargeIdentity(w http.ResponseWriter, r *http.Request,
+	identity string) bool {
+
+	c, ok := r.Context().Value(requestChargeCtxKey{}).(requestCharge)
+	if !ok {
+		return true
+	}
+	c.l.Return(c.key, 1)
+	ok, wait := c.l.Allow("identity:"+identity, 1)
+	if !ok {
+		rateLimitErr(r.Context(), w, wait, "rate limit exceeded")
+	}
+	return ok
+}
+
+// allowNodes takes n nodes from the node quota of the client. If the quota
+// is exceeded, 429 is written to w and false is returned. Requests with more
+// nodes than the whole quota can never succeed and get 413.
+func allowNodes(w http.ResponseWriter, r *http.Request, l *ratelimit.Limiter,
+	n int) bool {
+
+	if l == nil {
+		return true
+	}
+	if n > l.Burst() {
+		jsonErr(r.Context(), w, http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("%v nodes exceed the node quota of %v, "+
+				"split them into smaller requests", n, l.Burst()))
+		return false
+	}
+	ok, wait := l.Allow(clientKey(r), n)
+	if !ok {
+		rateLimitErr(r.Context(), w, wait, "node quota exceeded")
+	}
+	return ok
+}
+
+func rateLimitErr(ctx context.Context, w http.ResponseWriter,
+	wait time.Duration, e string) {
+
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	jsonErr(ctx, w, http.StatusTooManyRequests, e)
+}
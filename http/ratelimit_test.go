@@ -0,0 +1,153 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iden3/go-iden3-crypto/babyjub"
+	"github.com/iden3/reverse-hash-service/auth"
+	"github.com/iden3/reverse-hash-service/hashdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimits(t *testing.T) {
+	keys, err := auth.ParseKeys("alice:secret1,bob:secret2")
+	require.NoError(t, err)
+	ts := httptest.NewServer(Handler(hashdb.NewMemory(), WithAPIKeys(keys),
+		WithRateLimits(RateLimits{
+			ReadsPerSecond:  2,
+			Window:          time.Hour,
+			WritesPerWindow: 3,
+			NodesPerWindow:  3,
+		})))
+	defer ts.Close()
+
+	do := func(method, path, key, body string) (*http.Response, string) {
+		var headers map[string]string
+		if key != "" {
+			headers = map[string]string{"Authorization": "Bearer " + key}
+		}
+		return doRequest(t, ts, method, path, headers, body)
+	}
+
+	// reads are limited by IP
+	for i := 0; i < 2; i++ {
+		resp, _ := do(http.MethodGet, "/node/"+strings.Repeat("0", 64), "",
+			"")
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	}
+	resp, body := do(http.MethodGet, "/node/"+strings.Repeat("0", 64), "",
+		"")
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	require.Equal(t, "1", resp.Header.Get("Retry-After"))
+	require.JSONEq(t, `{"status":"error","error":"rate limit exceeded"}`,
+		body)
+
+	// nodes are counted per API key
+	resp, _ = do(http.MethodPost, "/node", "secret1",
+		"["+testNode+","+testLeaf+"]")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, body = do(http.MethodPost, "/nodes/stream", "secret1",
+		testNode+"\n"+testLeaf+"\n")
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	require.Equal(t, "1200", resp.Header.Get("Retry-After"))
+	require.JSONEq(t, `{"status":"error","error":"node quota exceeded"}`,
+		body)
+	resp, _ = do(http.MethodPost, "/node", "secret1", "["+testLeaf+"]")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the write request limit is exceeded
+	resp, body = do(http.MethodPost, "/node", "secret1", "[]")
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	require.JSONEq(t, `{"status":"error","error":"rate limit exceeded"}`,
+		body)
+
+	// other keys have their own limits
+	resp, _ = do(http.MethodPost, "/node", "secret2", "["+testNode+"]")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestRateLimits_SignedByIdentity(t *testing.T) {
+	key1 := babyjub.NewRandPrivKey()
+	key2 := babyjub.NewRandPrivKey()
+	signingKeys, err := auth.ParseSigningKeys(
+		"id1:" + key1.Public().Compress().String() +
+			",id2:" + key2.Public().Compress().String())
+	require.NoError(t, err)
+	ts := httptest.NewServer(Handler(hashdb.NewMemory(),
+		WithSigningKeys(signingKeys),
+		WithRateLimits(RateLimits{Window: time.Hour, WritesPerWindow: 1})))
+	defer ts.Close()
+
+	post := func(identity string, key babyjub.PrivateKey) int {
+		resp, _ := doRequest(t, ts, http.MethodPost, "/node",
+			map[string]string{"X-Identity": identity,
+				"X-Signature": signNode(t, key, testNodeHash)},
+			"["+testNode+"]")
+		return resp.StatusCode
+	}
+
+	// writes are counted per identity, not per IP
+	require.Equal(t, http.StatusOK, post("id1", key1))
+	require.Equal(t, http.StatusTooManyRequests, post("id1", key1))
+	require.Equal(t, http.StatusOK, post("id2", key2))
+}
+
+func TestRateLimits_ForgedSignature(t *testing.T) {
+	key := babyjub.NewRandPrivKey()
+	forgedKey := babyjub.NewRandPrivKey()
+	signingKeys, err := auth.ParseSigningKeys(
+		"id1:" + key.Public().Compress().String())
+	require.NoError(t, err)
+	ts := httptest.NewServer(Handler(hashdb.NewMemory(),
+		WithSigningKeys(signingKeys), WithProxyHeaders(),
+		WithRateLimits(RateLimits{Window: time.Hour, WritesPerWindow: 1})))
+	defer ts.Close()
+
+	post := func(ip string, key babyjub.PrivateKey) int {
+		resp, _ := doRequest(t, ts, http.MethodPost, "/node",
+			map[string]string{"X-Real-IP": ip, "X-Identity": "id1",
+				"X-Signature": signNode(t, key, testNodeHash)},
+			"["+testNode+"]")
+		return resp.StatusCode
+	}
+
+	// forged signatures are counted against the IP address of the sender
+	require.Equal(t, http.StatusUnauthorized, post("10.0.0.1", forgedKey))
+	require.Equal(t, http.StatusTooManyRequests, post("10.0.0.1", forgedKey))
+
+	// and don't use up the limit of the identity
+	require.Equal(t, http.StatusOK, post("10.0.0.2", key))
+	require.Equal(t, http.StatusTooManyRequests, post("10.0.0.3", key))
+}
+
+func TestRateLimits_OversizedBatch(t *testing.T) {
+	ts := httptest.NewServer(Handler(hashdb.NewMemory(),
+		WithRateLimits(RateLimits{Window: time.Hour, NodesPerWindow: 2})))
+	defer ts.Close()
+
+	post := func(path, body string) (int, string) {
+		resp, respBody := doRequest(t, ts, http.MethodPost, path, nil, body)
+		return resp.StatusCode, respBody
+	}
+
+	// a batch larger than the whole quota is rejected without waiting
+	code, body := post("/node", "["+testNode+","+testLeaf+","+testLeaf+"]")
+	require.Equal(t, http.StatusRequestEntityTooLarge, code)
+	require.JSONEq(t, `{"status":"error","error":"3 nodes exceed the node quota of 2, split them into smaller requests"}`,
+		body)
+
+	// streams are saved in chunks that fit into the quota, the first chunk
+	// shows that the rejected batch did not use up the quota
+	code, body = post("/nodes/stream",
+		testNode+"\n"+testLeaf+"\n"+testLeaf+"\n")
+	require.Equal(t, http.StatusTooManyRequests, code)
+	require.JSONEq(t, `{"status":"error","error":"node quota exceeded"}`,
+		body)
+	resp, _ := doRequest(t, ts, http.MethodGet, "/node/"+testNodeHash, nil,
+		"")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
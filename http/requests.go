@@ -36,6 +36,29 @@ func (n *nodeSubmitRequest) UnmarshalJSON(bytes []byte) error {
 	return nil
 }
 
+type nodesQueryRequest struct {
+	Hashes []merkletree.Hash
+}
+
+func (q *nodesQueryRequest) UnmarshalJSON(bytes []byte) error {
+	var obj struct {
+		Hashes []string `json:"hashes"`
+	}
+	err := json.Unmarshal(bytes, &obj)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	q.Hashes = make([]merkletree.Hash, len(obj.Hashes))
+	for i := range obj.Hashes {
+		err = unpackHash(&q.Hashes[i], obj.Hashes[i])
+		if err != nil {
+			return errors.Wrapf(err, "error parsing hash #%v", i+1)
+		}
+	}
+	return nil
+}
+
 func unpackHash(h *merkletree.Hash, i interface{}) error {
 	s, ok := i.(string)
 	if !ok {
@@ -47,3 +70,19 @@ func unpackHash(h *merkletree.Hash, i interface{}) error {
 	_, err := hex.Decode(h[:], []byte(s))
 	return errors.WithStack(err)
 }
+
+type statePublishRequest struct {
+	State merkletree.Hash
+}
+
+func (s *statePublishRequest) UnmarshalJSON(bytes []byte) error {
+	var obj struct {
+		State string `json:"state"`
+	}
+	err := json.Unmarshal(bytes, &obj)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.Wrap(unpackHash(&s.State, obj.State),
+		"error parsing state")
+}
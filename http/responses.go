@@ -1,10 +1,210 @@
 package http
 
 import (
+	"encoding/json"
+
+	"github.com/iden3/go-merkletree-sql"
 	"github.com/iden3/reverse-hash-service/hashdb"
+	"github.com/pkg/errors"
 )
 
 type nodeResponse struct {
 	Node   hashdb.Node `json:"node"`
 	Status string      `json:"status"`
 }
+
+type proofResponse struct {
+	Proof  hashdb.Proof `json:"proof"`
+	Status string       `json:"status"`
+}
+
+// treeState is a decomposed identity state node
+type treeState struct {
+	State          merkletree.Hash
+	ClaimsRoot     merkletree.Hash
+	RevocationRoot merkletree.Hash
+	RootOfRoots    merkletree.Hash
+}
+
+func (ts treeState) MarshalJSON() ([]byte, error) {
+	bytes, err := json.Marshal(map[string]interface{}{
+		"state":                ts.State.Hex(),
+		"claims_tree_root":     ts.ClaimsRoot.Hex(),
+		"revocation_tree_root": ts.RevocationRoot.Hex(),
+		"root_of_roots":        ts.RootOfRoots.Hex(),
+	})
+	return bytes, errors.WithStack(err)
+}
+
+type revocationResponse struct {
+	Proof     hashdb.Proof `json:"proof"`
+	TreeState treeState    `json:"tree_state"`
+	Status    string       `json:"status"`
+}
+
+type nodesQueryResponse struct {
+	Nodes   []hashdb.Node
+	Missing []merkletree.Hash
+	Status  string
+}
+
+func (r nodesQueryResponse) MarshalJSON() ([]byte, error) {
+	nodes := r.Nodes
+	if nodes == nil {
+		nodes = []hashdb.Node{}
+	}
+	missing := make([]string, len(r.Missing))
+	for i := range r.Missing {
+		missing[i] = r.Missing[i].Hex()
+	}
+	bytes, err := json.Marshal(map[string]interface{}{
+		"nodes":   nodes,
+		"missing": missing,
+		"status":  r.Status,
+	})
+	return bytes, errors.WithStack(err)
+}
+
+// nodeSubmitCheckResponse lists children of submitted nodes missing from
+// storage
+type nodeSubmitCheckResponse struct {
+	Dangling []merkletree.Hash
+	Status   string
+}
+
+func (r nodeSubmitCheckResponse) MarshalJSON() ([]byte, error) {
+	dangling := make([]string, len(r.Dangling))
+	for i := range r.Dangling {
+		dangling[i] = r.Dangling[i].Hex()
+	}
+	bytes, err := json.Marshal(map[string]interface{}{
+		keyStatus:  r.Status,
+		"dangling": dangling,
+	})
+	return bytes, errors.WithStack(err)
+}
+
+// invalidNodesResponse lists nodes rejected by storage
+type invalidNodesResponse struct {
+	Errors hashdb.NodeErrors
+	Status string
+}
+
+func (r invalidNodesResponse) MarshalJSON() ([]byte, error) {
+	nodeErrs := make([]map[string]interface{}, len(r.Errors))
+	for i := range r.Errors {
+		nodeErrs[i] = map[string]interface{}{
+			"index": r.Errors[i].Index,
+			"hash":  r.Errors[i].Hash.Hex(),
+			"error": r.Errors[i].Err.Error(),
+		}
+	}
+	bytes, err := json.Marshal(map[string]interface{}{
+		keyStatus: r.Status,
+		keyError:  "invalid nodes",
+		"errors":  nodeErrs,
+	})
+	return bytes, errors.WithStack(err)
+}
+
+type lineError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+type nodesStreamResponse struct {
+	// number of non-empty lines read
+	Received int `json:"received"`
+	// number of valid nodes saved, including already existing ones
+	Saved int `json:"saved"`
+	// number of nodes that did not exist in storage before
+	Inserted int `json:"inserted"`
+	// number of invalid lines
+	Failed int         `json:"failed"`
+	Errors []lineError `json:"errors"`
+	Status string      `json:"status"`
+}
+
+// addLineError counts the failed line. Only first streamMaxErrors errors are
+// kept to limit the response size.
+func (r *nodesStreamResponse) addLineError(line int, err error) {
+	r.Failed++
+	if len(r.Errors) < streamMaxErrors {
+		r.Errors = append(r.Errors, lineError{line, err.Error()})
+	}
+}
+
+type stateResponse struct {
+	Publication hashdb.StatePublication
+	Status      string
+}
+
+func (r stateResponse) MarshalJSON() ([]byte, error) {
+	bytes, err := json.Marshal(map[string]interface{}{
+		"identity":     r.Publication.Identity,
+		"state":        r.Publication.State.Hex(),
+		"published_at": r.Publication.PublishedAt,
+		"status":       r.Status,
+	})
+	return bytes, errors.WithStack(err)
+}
+
+// statesResponse is the history of identity states
+type statesResponse struct {
+	Identity     string
+	Publications []hashdb.StatePublication
+	Status       string
+}
+
+func (r statesResponse) MarshalJSON() ([]byte, error) {
+	states := make([]map[string]interface{}, len(r.Publications))
+	for i := range r.Publications {
+		states[i] = map[string]interface{}{
+			"state":        r.Publications[i].State.Hex(),
+			"published_at": r.Publications[i].PublishedAt,
+		}
+	}
+	bytes, err := json.Marshal(map[string]interface{}{
+		"identity": r.Identity,
+		"states":   states,
+		"status":   r.Status,
+	})
+	return bytes, errors.WithStack(err)
+}
+
+// submissionsResponse lists logged node submissions
+type submissionsResponse struct {
+	Submissions []hashdb.Submission
+	Status      string
+}
+
+func (r submissionsResponse) MarshalJSON() ([]byte, error) {
+	// empty submitters are reported as null
+	nullable := func(s string) interface{} {
+		if s == "" {
+			return nil
+		}
+		return s
+	}
+	subs := make([]map[string]interface{}, len(r.Submissions))
+	for i, s := range r.Submissions {
+		hashes := make([]string, len(s.Inserted))
+		for j := range s.Inserted {
+			hashes[j] = s.Inserted[j].Hex()
+		}
+		subs[i] = map[string]interface{}{
+			"request_id":         s.RequestID,
+			"submitter":          nullable(s.Submitter),
+			"submitter_identity": nullable(s.SubmitterIdentity),
+			"submitted_at":       s.SubmittedAt,
+			"nodes":              s.Nodes,
+			"inserted":           len(s.Inserted),
+			"hashes":             hashes,
+		}
+	}
+	bytes, err := json.Marshal(map[string]interface{}{
+		"submissions": subs,
+		"status":      r.Status,
+	})
+	return bytes, errors.WithStack(err)
+}
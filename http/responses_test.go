@@ -28,7 +28,8 @@ func TestNodeResponse_MarshalJSON(t *testing.T) {
       "037c4d7bbb0407b8000000000000000000000000000000000000000000000000",
       "0000000000000000000000000000000000000000000000000000000000000000",
       "0100000000000000000000000000000000000000000000000000000000000000"
-    ]
+    ],
+    "type": "leaf"
   }
 }`
 	require.JSONEq(t, want, string(data))
@@ -48,7 +49,8 @@ func TestNodeResponse_MarshalJSON(t *testing.T) {
     "children": [
       "658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e",
       "e809a4ed2cf98922910e456f1e56862bb958777f5ff0ea6799360113257f220f"
-    ]
+    ],
+    "type": "middle"
   }
 }`
 	require.JSONEq(t, want, string(data))
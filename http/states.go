@@ -0,0 +1,213 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	stderr "errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/reverse-hash-service/auth"
+	"github.com/iden3/reverse-hash-service/hashdb"
+	"github.com/iden3/reverse-hash-service/log"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// number of states returned by /identity/{id}/states by default
+	defaultStatesLimit = 100
+	// maximum value of limit query parameter of /identity/{id}/states
+	maxStatesLimit = 1000
+)
+
+// identity IDs are base58 strings, DIDs are accepted too
+var identityRe = regexp.MustCompile(`^[A-Za-z0-9:._-]{1,256}$`)
+
+type stateRegistry interface {
+	PublishState(ctx context.Context, identity string,
+		state merkletree.Hash) (hashdb.StatePublication, error)
+	LatestState(ctx context.Context,
+		identity string) (hashdb.StatePublication, error)
+	States(ctx context.Context, identity string,
+		limit int) ([]hashdb.StatePublication, error)
+}
+
+func identityParam(r *http.Request) (string, error) {
+	identity := chi.URLParam(r, paramIdentity)
+	if !identityRe.MatchString(identity) {
+		return "", errors.Errorf("invalid identity: %q", identity)
+	}
+	return identity, nil
+}
+
+type identityGrants interface {
+	Allowed(name, identity string) bool
+}
+
+// getStatePublishHandler records a new latest state of identity. The state
+// node must be submitted before with POST /node. The request must be signed
+// by the identity or made with an API key granted for the identity, see
+// authorizeStatePublish.
+func getStatePublishHandler(states stateRegistry, storage nodesGetter,
+	grants identityGrants) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		identity, err := identityParam(r)
+		if err != nil {
+			jsonErr(ctx, w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var req statePublishRequest
+		err = json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			jsonErr(ctx, w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if !authorizeStatePublish(w, r, identity, req.State, grants) {
+			return
+		}
+
+		node, err := storage.ByHash(ctx, req.State)
+		if stderr.Is(err, hashdb.ErrDoesNotExists) {
+			jsonErr(ctx, w, http.StatusBadRequest,
+				fmt.Sprintf("state node %v not found", req.State.Hex()))
+			return
+		} else if err != nil {
+			log.WithContext(ctx).Errorw(err.Error(), zap.Error(err))
+			jsonErr(ctx, w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if node.Type() != hashdb.NodeTypeState {
+			jsonErr(ctx, w, http.StatusBadRequest,
+				fmt.Sprintf("node %v is not an identity state",
+					req.State.Hex()))
+			return
+		}
+
+		pub, err := states.PublishState(ctx, identity, req.State)
+		if stderr.Is(err, hashdb.ErrStateExists) {
+			jsonErr(ctx, w, http.StatusConflict,
+				fmt.Sprintf("state %v is already registered",
+					req.State.Hex()))
+			return
+		} else if err != nil {
+			log.WithContext(ctx).Errorw(err.Error(), zap.Error(err))
+			jsonErr(ctx, w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		jsonResp(ctx, w, http.StatusOK, stateResponse{pub, statusOK})
+	}
+}
+
+// authorizeStatePublish checks that the request proves control of identity:
+// it is signed by the identity key (see requireAPIKeyOrSignature) or made
+// with an API key that grants allow for the identity. Otherwise an error is
+// written to w and false is returned.
+func authorizeStatePublish(w http.ResponseWriter, r *http.Request,
+	identity string, state merkletree.Hash, grants identityGrants) bool {
+
+	ctx := r.Context()
+	if s, ok := ctx.Value(signedSubmissionCtxKey{}).(signedSubmission); ok {
+		if s.identity != identity {
+			jsonErr(ctx, w, http.StatusForbidden,
+				"request is signed by another identity")
+			return false
+		}
+		err := auth.VerifyState(s.key, state, s.signature)
+		if stderr.Is(err, auth.ErrInvalidSignature) {
+			jsonErr(ctx, w, http.StatusUnauthorized, "invalid signature")
+			return false
+		} else if err != nil {
+			log.WithContext(ctx).Errorw(err.Error(), zap.Error(err))
+			jsonErr(ctx, w, http.StatusInternalServerError, err.Error())
+			return false
+		}
+		return chargeIdentity(w, r, identity)
+	}
+
+	name := hashdb.SubmitterFrom(ctx)
+	if name != "" && grants != nil && grants.Allowed(name, identity) {
+		return true
+	}
+	jsonErr(ctx, w, http.StatusForbidden,
+		fmt.Sprintf("not allowed to publish states of %v", identity))
+	return false
+}
+
+func getLatestStateHandler(states stateRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		identity, err := identityParam(r)
+		if err != nil {
+			jsonErr(ctx, w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		pub, err := states.LatestState(ctx, identity)
+		if stderr.Is(err, hashdb.ErrDoesNotExists) {
+			jsonResp(ctx, w, http.StatusNotFound,
+				map[string]interface{}{keyStatus: statusNotFound})
+			return
+		} else if err != nil {
+			log.WithContext(ctx).Errorw(err.Error(), zap.Error(err))
+			jsonErr(ctx, w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		// the latest state changes, so unlike nodes it must not be cached
+		w.Header().Set("Cache-Control", "no-cache")
+		jsonResp(ctx, w, http.StatusOK, stateResponse{pub, statusOK})
+	}
+}
+
+// getStatesHandler returns the history of identity states, latest first
+func getStatesHandler(states stateRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		identity, err := identityParam(r)
+		if err != nil {
+			jsonErr(ctx, w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		limit, err := limitParam(r, defaultStatesLimit, maxStatesLimit)
+		if err != nil {
+			jsonErr(ctx, w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		pubs, err := states.States(ctx, identity, limit)
+		if err != nil {
+			log.WithContext(ctx).Errorw(err.Error(), zap.Error(err))
+			jsonErr(ctx, w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-cache")
+		jsonResp(ctx, w, http.StatusOK,
+			statesResponse{identity, pubs, statusOK})
+	}
+}
+
+// limitParam returns the value of limit query parameter or def if it is not
+// set
+func limitParam(r *http.Request, def, max int) (int, error) {
+	v := r.URL.Query().Get(queryLimit)
+	if v == "" {
+		return def, nil
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit < 1 || limit > max {
+		return 0, errors.Errorf("%v should be a number from 1 to %v",
+			queryLimit, max)
+	}
+	return limit, nil
+}
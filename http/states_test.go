@@ -0,0 +1,188 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iden3/go-iden3-crypto/babyjub"
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/reverse-hash-service/auth"
+	"github.com/iden3/reverse-hash-service/hashdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateRegistryHandlers(t *testing.T) {
+	ctx := context.Background()
+	const identity = "114vgnnCupQMX4wqUBjg5kUya3zMXfPmKc9HNH4TSE"
+	keys, err := auth.ParseKeys("alice:secret1,bob:secret2")
+	require.NoError(t, err)
+	ki, err := auth.ParseKeyIdentities("alice:" + identity)
+	require.NoError(t, err)
+	storage := hashdb.NewMemory()
+	ts := httptest.NewServer(Handler(storage,
+		WithStateRegistry(hashdb.NewMemoryStateRegistry()),
+		WithAPIKeys(keys), WithKeyIdentities(ki)))
+	defer ts.Close()
+
+	state := hashdb.Node{Children: []merkletree.Hash{
+		{1}, merkletree.HashZero, merkletree.HashZero}}
+	h, err := merkletree.HashElems(state.Children[0].BigInt(),
+		state.Children[1].BigInt(), state.Children[2].BigInt())
+	require.NoError(t, err)
+	state.Hash = *h
+	middle := hashdb.Node{Children: []merkletree.Hash{{1}, {2}}}
+	h, err = merkletree.HashElems(middle.Children[0].BigInt(),
+		middle.Children[1].BigInt())
+	require.NoError(t, err)
+	middle.Hash = *h
+	_, err = storage.SaveNodes(ctx, []hashdb.Node{state, middle})
+	require.NoError(t, err)
+
+	apiKey := "secret1"
+	do := func(method, path, body string) (int, map[string]interface{}) {
+		resp, respBody := doRequest(t, ts, method, path,
+			map[string]string{"X-API-Key": apiKey}, body)
+		var obj map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(respBody), &obj), respBody)
+		return resp.StatusCode, obj
+	}
+
+	code, obj := do(http.MethodGet, "/identity/"+identity+"/state/latest",
+		"")
+	require.Equal(t, http.StatusNotFound, code)
+	require.Equal(t, statusNotFound, obj["status"])
+
+	code, obj = do(http.MethodPost, "/identity/"+identity+"/state",
+		`{"state":"`+middle.Hash.Hex()+`"}`)
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Equal(t, "node "+middle.Hash.Hex()+" is not an identity state",
+		obj["error"])
+
+	code, obj = do(http.MethodPost, "/identity/"+identity+"/state",
+		`{"state":"`+merkletree.Hash{5}.Hex()+`"}`)
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Equal(t, "state node "+merkletree.Hash{5}.Hex()+" not found",
+		obj["error"])
+
+	code, obj = do(http.MethodPost, "/identity/bad%20id/state",
+		`{"state":"`+state.Hash.Hex()+`"}`)
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Equal(t, `invalid identity: "bad id"`, obj["error"])
+
+	code, obj = do(http.MethodPost, "/identity/"+identity+"/state",
+		`{"state":"`+state.Hash.Hex()+`"}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, identity, obj["identity"])
+	require.Equal(t, state.Hash.Hex(), obj["state"])
+	publishedAt := obj["published_at"]
+	require.NotEmpty(t, publishedAt)
+
+	code, obj = do(http.MethodPost, "/identity/"+identity+"/state",
+		`{"state":"`+state.Hash.Hex()+`"}`)
+	require.Equal(t, http.StatusConflict, code)
+	require.Equal(t, "state "+state.Hash.Hex()+" is already registered",
+		obj["error"])
+
+	// bob may not publish states of identity
+	apiKey = "secret2"
+	code, obj = do(http.MethodPost, "/identity/"+identity+"/state",
+		`{"state":"`+state.Hash.Hex()+`"}`)
+	require.Equal(t, http.StatusForbidden, code)
+	require.Equal(t, "not allowed to publish states of "+identity,
+		obj["error"])
+	apiKey = "secret1"
+
+	code, obj = do(http.MethodGet, "/identity/"+identity+"/state/latest",
+		"")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, map[string]interface{}{
+		"identity":     identity,
+		"state":        state.Hash.Hex(),
+		"published_at": publishedAt,
+		"status":       statusOK,
+	}, obj)
+
+	code, obj = do(http.MethodGet, "/identity/"+identity+"/states", "")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, map[string]interface{}{
+		"identity": identity,
+		"states": []interface{}{map[string]interface{}{
+			"state":        state.Hash.Hex(),
+			"published_at": publishedAt,
+		}},
+		"status": statusOK,
+	}, obj)
+
+	code, obj = do(http.MethodGet, "/identity/"+identity+"/states?limit=0",
+		"")
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Equal(t, "limit should be a number from 1 to 1000", obj["error"])
+}
+
+func TestStateRegistryHandlers_Disabled(t *testing.T) {
+	ts := httptest.NewServer(Handler(hashdb.NewMemory()))
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + "/identity/abc/state/latest")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestStatePublishHandler_Signed(t *testing.T) {
+	ctx := context.Background()
+	const identity = "did:iden3:polygon:mumbai:x1"
+	privKey := babyjub.NewRandPrivKey()
+	otherKey := babyjub.NewRandPrivKey()
+	signingKeys, err := auth.ParseSigningKeys(
+		identity + ":" + privKey.Public().Compress().String() +
+			",other:" + otherKey.Public().Compress().String())
+	require.NoError(t, err)
+	storage := hashdb.NewMemory()
+	ts := httptest.NewServer(Handler(storage,
+		WithStateRegistry(hashdb.NewMemoryStateRegistry()),
+		WithSigningKeys(signingKeys)))
+	defer ts.Close()
+
+	state := hashdb.Node{Children: []merkletree.Hash{
+		{1}, merkletree.HashZero, merkletree.HashZero}}
+	h, err := merkletree.HashElems(state.Children[0].BigInt(),
+		state.Children[1].BigInt(), state.Children[2].BigInt())
+	require.NoError(t, err)
+	state.Hash = *h
+	_, err = storage.SaveNodes(ctx, []hashdb.Node{state})
+	require.NoError(t, err)
+
+	m, err := auth.StateMessage(state.Hash)
+	require.NoError(t, err)
+	sig := privKey.SignPoseidon(m).Compress().String()
+
+	post := func(path string, headers map[string]string) (int, string) {
+		resp, body := doRequest(t, ts, http.MethodPost, path, headers,
+			`{"state":"`+state.Hash.Hex()+`"}`)
+		return resp.StatusCode, body
+	}
+	path := "/identity/" + identity + "/state"
+
+	code, body := post(path, nil)
+	require.Equal(t, http.StatusUnauthorized, code, body)
+
+	// the signature of identity can't publish states of another identity
+	code, body = post("/identity/other/state",
+		map[string]string{"X-Identity": identity, "X-Signature": sig})
+	require.Equal(t, http.StatusForbidden, code)
+	require.JSONEq(t,
+		`{"status":"error","error":"request is signed by another identity"}`,
+		body)
+
+	code, body = post(path, map[string]string{"X-Identity": identity,
+		"X-Signature": otherKey.SignPoseidon(m).Compress().String()})
+	require.Equal(t, http.StatusUnauthorized, code)
+	require.JSONEq(t, `{"status":"error","error":"invalid signature"}`, body)
+
+	code, body = post(path,
+		map[string]string{"X-Identity": identity, "X-Signature": sig})
+	require.Equal(t, http.StatusOK, code, body)
+}
@@ -0,0 +1,95 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/reverse-hash-service/hashdb"
+	"github.com/iden3/reverse-hash-service/log"
+	"go.uber.org/zap"
+)
+
+const (
+	// number of submissions returned by /admin/submissions by default
+	defaultSubmissionsLimit = 100
+	// maximum value of limit query parameter of /admin/submissions
+	maxSubmissionsLimit = 1000
+)
+
+type submissionQuerier interface {
+	Submissions(ctx context.Context,
+		f hashdb.SubmissionFilter) ([]hashdb.Submission, error)
+}
+
+// withSubmissionLog makes storage record nodes saved with the returned
+// context in subs, see hashdb.WithSubmissionLog. With nil subs ctx is
+// returned.
+func withSubmissionLog(ctx context.Context,
+	subs hashdb.SubmissionLog) context.Context {
+
+	if subs == nil {
+		return ctx
+	}
+	return hashdb.WithSubmissionLog(ctx, subs, middleware.GetReqID(ctx))
+}
+
+// getSubmissionsHandler returns logged submissions, latest first
+func getSubmissionsHandler(subs submissionQuerier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		q := r.URL.Query()
+		f := hashdb.SubmissionFilter{
+			Submitter:         q.Get(querySubmitter),
+			SubmitterIdentity: q.Get(queryIdentity),
+		}
+
+		if v := q.Get(paramHash); v != "" {
+			h, err := merkletree.NewHashFromHex(v)
+			if err != nil {
+				jsonErr(ctx, w, http.StatusBadRequest,
+					fmt.Sprintf("invalid %v: %v", paramHash, err))
+				return
+			}
+			f.Hash = h
+		}
+
+		for _, p := range []struct {
+			name string
+			t    *time.Time
+		}{{querySince, &f.Since}, {queryUntil, &f.Until}} {
+			v := q.Get(p.name)
+			if v == "" {
+				continue
+			}
+			var err error
+			*p.t, err = time.Parse(time.RFC3339, v)
+			if err != nil {
+				jsonErr(ctx, w, http.StatusBadRequest,
+					fmt.Sprintf("%v should be an RFC 3339 time", p.name))
+				return
+			}
+		}
+
+		var err error
+		f.Limit, err = limitParam(r, defaultSubmissionsLimit,
+			maxSubmissionsLimit)
+		if err != nil {
+			jsonErr(ctx, w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		res, err := subs.Submissions(ctx, f)
+		if err != nil {
+			log.WithContext(ctx).Errorw(err.Error(), zap.Error(err))
+			jsonErr(ctx, w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-cache")
+		jsonResp(ctx, w, http.StatusOK, submissionsResponse{res, statusOK})
+	}
+}
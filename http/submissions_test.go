@@ -0,0 +1,148 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iden3/reverse-hash-service/auth"
+	"github.com/iden3/reverse-hash-service/hashdb"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubmissionLog(t *testing.T) {
+	keys, err := auth.ParseKeys("alice:secret1")
+	require.NoError(t, err)
+	adminKeys, err := auth.ParseKeys("admin:secret2")
+	require.NoError(t, err)
+	ts := httptest.NewServer(Handler(hashdb.NewMemory(), WithAPIKeys(keys),
+		WithAdminKeys(adminKeys),
+		WithSubmissionLog(hashdb.NewMemorySubmissionLog())))
+	defer ts.Close()
+
+	do := func(method, path string, headers map[string]string,
+		body string) (int, string) {
+
+		resp, respBody := doRequest(t, ts, method, path, headers, body)
+		return resp.StatusCode, respBody
+	}
+
+	for _, reqID := range []string{"req-1", "req-2"} {
+		code, _ := do(http.MethodPost, "/node", map[string]string{
+			"X-API-Key": "secret1", "X-Request-Id": reqID},
+			"["+testNode+"]")
+		require.Equal(t, http.StatusOK, code)
+	}
+
+	// submitter keys can't read the log
+	code, _ := do(http.MethodGet, "/admin/submissions",
+		map[string]string{"X-API-Key": "secret1"}, "")
+	require.Equal(t, http.StatusUnauthorized, code)
+
+	type submission struct {
+		RequestID         string   `json:"request_id"`
+		Submitter         *string  `json:"submitter"`
+		SubmitterIdentity *string  `json:"submitter_identity"`
+		SubmittedAt       string   `json:"submitted_at"`
+		Nodes             int      `json:"nodes"`
+		Inserted          int      `json:"inserted"`
+		Hashes            []string `json:"hashes"`
+	}
+	getSubmissions := func(query string) []submission {
+		code, body := do(http.MethodGet, "/admin/submissions"+query,
+			map[string]string{"X-API-Key": "secret2"}, "")
+		require.Equal(t, http.StatusOK, code, body)
+		var resp struct {
+			Submissions []submission `json:"submissions"`
+			Status      string       `json:"status"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(body), &resp))
+		require.Equal(t, statusOK, resp.Status)
+		return resp.Submissions
+	}
+
+	subs := getSubmissions("")
+	require.Len(t, subs, 2)
+	// the node is inserted by the first submission only
+	require.Equal(t, "req-2", subs[0].RequestID)
+	require.Equal(t, 1, subs[0].Nodes)
+	require.Equal(t, 0, subs[0].Inserted)
+	require.Equal(t, []string{}, subs[0].Hashes)
+	require.Equal(t, "req-1", subs[1].RequestID)
+	require.Equal(t, "alice", *subs[1].Submitter)
+	require.Nil(t, subs[1].SubmitterIdentity)
+	require.NotEmpty(t, subs[1].SubmittedAt)
+	require.Equal(t, 1, subs[1].Nodes)
+	require.Equal(t, 1, subs[1].Inserted)
+	require.Equal(t, []string{testNodeHash}, subs[1].Hashes)
+
+	subs = getSubmissions("?hash=" + testNodeHash)
+	require.Len(t, subs, 1)
+	require.Equal(t, "req-1", subs[0].RequestID)
+
+	require.Len(t, getSubmissions("?limit=1"), 1)
+	require.Empty(t, getSubmissions("?submitter=bob"))
+	require.Empty(t, getSubmissions("?until=2000-01-01T00:00:00Z"))
+
+	code, body := do(http.MethodGet, "/admin/submissions?since=yesterday",
+		map[string]string{"X-API-Key": "secret2"}, "")
+	require.Equal(t, http.StatusBadRequest, code)
+	require.JSONEq(t,
+		`{"status":"error","error":"since should be an RFC 3339 time"}`,
+		body)
+}
+
+func TestSubmissionLog_Stream(t *testing.T) {
+	subs := hashdb.NewMemorySubmissionLog()
+	ts := httptest.NewServer(Handler(hashdb.NewMemory(),
+		WithSubmissionLog(subs)))
+	defer ts.Close()
+
+	resp, _ := doRequest(t, ts, http.MethodPost, "/nodes/stream",
+		map[string]string{"X-Request-Id": "req-1"},
+		testNode+"\n"+testNode+"\n")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	res, err := subs.Submissions(context.Background(),
+		hashdb.SubmissionFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	require.Equal(t, "req-1", res[0].RequestID)
+	require.Equal(t, 2, res[0].Nodes)
+	require.Len(t, res[0].Inserted, 1)
+	require.Equal(t, testNodeHash, res[0].Inserted[0].Hex())
+}
+
+type failingSubmissionLog struct {
+	hashdb.SubmissionLog
+}
+
+func (failingSubmissionLog) LogSubmission(context.Context,
+	hashdb.Submission) (hashdb.Submission, error) {
+
+	return hashdb.Submission{}, errors.New("log is not available")
+}
+
+func TestSubmissionLog_Failure(t *testing.T) {
+	ts := httptest.NewServer(Handler(hashdb.NewMemory(),
+		WithSubmissionLog(failingSubmissionLog{})))
+	defer ts.Close()
+
+	// submissions that are not logged fail
+	for path, body := range map[string]string{
+		"/node":         "[" + testNode + "]",
+		"/nodes/stream": testNode,
+	} {
+		resp, _ := doRequest(t, ts, http.MethodPost, path, nil, body)
+		require.Equal(t, http.StatusInternalServerError, resp.StatusCode,
+			path)
+	}
+
+	// and save nothing, so they can be retried
+	resp, _ := doRequest(t, ts, http.MethodGet, "/node/"+testNodeHash, nil,
+		"")
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -3,17 +3,23 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/iden3/reverse-hash-service/auth"
 	"github.com/iden3/reverse-hash-service/hashdb"
 	"github.com/iden3/reverse-hash-service/http"
 	"github.com/iden3/reverse-hash-service/log"
+	"github.com/iden3/reverse-hash-service/metrics"
+	"github.com/iden3/reverse-hash-service/upstream"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
+	"go.etcd.io/bbolt"
 	"go.uber.org/zap"
 )
 
@@ -21,6 +27,85 @@ import (
 const (
 	cfgDb         = "db"
 	cfgListenAddr = "listen_addr"
+	cfgStorage    = "storage"
+	cfgBoltPath   = "bolt_path"
+	// maximum number of nodes in cache, 0 disables cache
+	cfgCacheSize = "cache_size"
+	// how long to remember that a node does not exist
+	cfgCacheNegativeTTL = "cache_negative_ttl"
+	// apply database migrations on start
+	cfgAutoMigrate = "auto_migrate"
+	// reject nodes of shapes the iden3 protocol never produces
+	cfgStrictNodes = "strict_nodes"
+	// URL of RHS to replicate trees from, empty disables replication
+	cfgUpstreamURL = "upstream_url"
+	// comma separated root or identity state hashes of trees to replicate
+	cfgUpstreamRoots = "upstream_roots"
+	// how often to sync trees from upstream, 0 syncs once on start
+	cfgUpstreamSyncInterval = "upstream_sync_interval"
+	// comma separated URLs of RHS to fetch nodes not found locally from
+	cfgFillUpstreams = "fill_upstreams"
+	// comma separated name:key pairs of API keys allowed to write
+	cfgAPIKeys = "api_keys"
+	// comma separated name:key pairs of API keys allowed to use admin routes
+	cfgAdminAPIKeys = "admin_api_keys"
+	// also accept API keys from the api_key database table
+	cfgAPIKeysDB = "api_keys_db"
+	// comma separated name:identity pairs of API keys allowed to publish
+	// states of identities
+	cfgAPIKeyIdentities = "api_key_identities"
+	// comma separated identity:key pairs of BabyJubJub public keys allowed
+	// to sign node submissions
+	cfgSigningKeys = "signing_keys"
+	// comma separated origins allowed by CORS, all by default
+	cfgCORSOrigins = "cors_allowed_origins"
+	// take client IP addresses from X-Forwarded-For and X-Real-IP headers
+	cfgTrustProxyHeaders = "trust_proxy_headers"
+	// requests per second to read routes per client IP, 0 disables the limit
+	cfgRateLimitReads = "rate_limit_reads"
+	// time window of write limits
+	cfgRateLimitWindow = "rate_limit_window"
+	// requests per window to write routes per client, 0 disables the limit
+	cfgRateLimitWrites = "rate_limit_writes"
+	// submitted nodes per window per client, 0 disables the limit
+	cfgRateLimitNodes = "rate_limit_nodes"
+)
+
+// commands
+const (
+	cmdServe        = "serve"
+	cmdMigrate      = "migrate"
+	cmdAudit        = "audit"
+	cmdExport       = "export"
+	cmdImport       = "import"
+	cmdGC           = "gc"
+	cmdPublishState = "publish-state"
+	cmdAPIKey       = "apikey"
+)
+
+const usage = `Usage: reverse-hash-service [command]
+
+Commands:
+  serve           start HTTP server (default)
+  migrate         apply database migrations
+  audit ROOT...   check integrity of trees with given root hashes
+  export [-o FILE] [ROOT...]
+                  dump all nodes or nodes of trees with given root hashes
+  import [FILE]   load nodes from a dump
+  gc [-dry-run] [-keep-states N] [-grace DURATION] [-roots FILE] [ROOT...]
+                  delete nodes not reachable from given root hashes, last
+                  registered states and recently saved nodes
+  publish-state IDENTITY STATE
+                  record a submitted state node as the latest state of
+                  identity
+  apikey add|revoke NAME
+                  create a new API key or revoke the active one in database
+`
+
+// storage types
+const (
+	storagePostgres = "postgres"
+	storageBolt     = "bolt"
 )
 
 func setupConfig() *viper.Viper {
@@ -30,6 +115,19 @@ func setupConfig() *viper.Viper {
 	v.AddConfigPath(".")
 	v.SetDefault(cfgDb, "database=rhs")
 	v.SetDefault(cfgListenAddr, ":8080")
+	v.SetDefault(cfgStorage, storagePostgres)
+	v.SetDefault(cfgBoltPath, "rhs.db")
+	v.SetDefault(cfgCacheSize, 10000)
+	v.SetDefault(cfgCacheNegativeTTL, 5*time.Second)
+	v.SetDefault(cfgAutoMigrate, false)
+	v.SetDefault(cfgStrictNodes, false)
+	v.SetDefault(cfgUpstreamSyncInterval, time.Minute)
+	v.SetDefault(cfgAPIKeysDB, false)
+	v.SetDefault(cfgTrustProxyHeaders, false)
+	v.SetDefault(cfgRateLimitReads, 0)
+	v.SetDefault(cfgRateLimitWindow, time.Minute)
+	v.SetDefault(cfgRateLimitWrites, 0)
+	v.SetDefault(cfgRateLimitNodes, 0)
 	err := v.ReadInConfig()
 	if err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
@@ -42,6 +140,11 @@ func setupConfig() *viper.Viper {
 }
 
 func main() {
+	os.Exit(run())
+}
+
+// run executes the command and returns process exit code
+func run() int {
 	v := setupConfig()
 
 	if err := log.Setup(); err != nil {
@@ -50,28 +153,99 @@ func main() {
 	// Syncing of console causes error. Ignore any errors on Sync.
 	defer func() { _ = log.Sync() }()
 
-	pxpoolConfig, err := pgxpool.ParseConfig(v.GetString(cfgDb))
-	if err != nil {
-		panic(err)
+	cmd := cmdServe
+	if len(os.Args) > 1 {
+		cmd = os.Args[1]
 	}
-	pxpoolConfig.LazyConnect = true
-
-	conn, err := pgxpool.ConnectConfig(context.Background(), pxpoolConfig)
-	if err != nil {
-		panic(err)
+	switch cmd {
+	case cmdServe:
+		serve(v)
+	case cmdMigrate:
+		migrate(v)
+	case cmdAudit:
+		return audit(v, os.Args[2:])
+	case cmdExport:
+		return exportNodes(v, os.Args[2:])
+	case cmdImport:
+		return importNodes(v, os.Args[2:])
+	case cmdGC:
+		return gc(v, os.Args[2:])
+	case cmdPublishState:
+		return publishState(v, os.Args[2:])
+	case cmdAPIKey:
+		return apiKey(v, os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return 2
 	}
-	defer conn.Close()
+	return 0
+}
 
-	err = conn.Ping(context.Background())
-	if err != nil {
-		log.Warnf("database error, start without database connection: %+v",
-			errors.WithStack(err))
-		err = nil
+func serve(v *viper.Viper) {
+	s := setupStorage(v)
+	defer s.close()
+	storage := s.nodes
+	if urls := splitList(v.GetString(cfgFillUpstreams)); len(urls) != 0 {
+		var remotes []*upstream.Client
+		for _, url := range urls {
+			remotes = append(remotes, upstream.NewClient(url))
+		}
+		log.Infof("Nodes not found locally are fetched from %v", urls)
+		storage = upstream.NewFillStorage(storage, remotes...)
 	}
+	if cacheSize := v.GetInt(cfgCacheSize); cacheSize > 0 {
+		cache := hashdb.NewCache(storage, cacheSize,
+			v.GetDuration(cfgCacheNegativeTTL))
+		metrics.RegisterCache(cache)
+		storage = cache
+	}
+	storage = metrics.NewStorage(storage)
 
-	storage := hashdb.New(conn)
-
-	httpSrv := http.New(v.GetString(cfgListenAddr), storage)
+	httpOpts := []http.Option{http.WithStateRegistry(s.states),
+		http.WithSubmissionLog(s.submissions)}
+	if s.nodeMeta != nil {
+		httpOpts = append(httpOpts, http.WithNodeMeta(s.nodeMeta))
+	}
+	keys := setupAPIKeys(v, s)
+	if keys != nil {
+		httpOpts = append(httpOpts, http.WithAPIKeys(keys))
+	} else if v.GetString(cfgSigningKeys) == "" {
+		log.Warnf("API keys are not configured, anyone can submit nodes")
+	}
+	if cfgKeys := v.GetString(cfgAdminAPIKeys); cfgKeys != "" {
+		adminKeys, err := auth.ParseKeys(cfgKeys)
+		if err != nil {
+			panic(err)
+		}
+		httpOpts = append(httpOpts, http.WithAdminKeys(adminKeys))
+	}
+	if cfgKI := v.GetString(cfgAPIKeyIdentities); cfgKI != "" {
+		ki, err := auth.ParseKeyIdentities(cfgKI)
+		if err != nil {
+			panic(err)
+		}
+		httpOpts = append(httpOpts, http.WithKeyIdentities(ki))
+	}
+	if cfgKeys := v.GetString(cfgSigningKeys); cfgKeys != "" {
+		signingKeys, err := auth.ParseSigningKeys(cfgKeys)
+		if err != nil {
+			panic(err)
+		}
+		httpOpts = append(httpOpts, http.WithSigningKeys(signingKeys))
+	}
+	if origins := splitList(v.GetString(cfgCORSOrigins)); len(origins) != 0 {
+		httpOpts = append(httpOpts, http.WithAllowedOrigins(origins))
+	}
+	if v.GetBool(cfgTrustProxyHeaders) {
+		httpOpts = append(httpOpts, http.WithProxyHeaders())
+	}
+	httpOpts = append(httpOpts, http.WithRateLimits(http.RateLimits{
+		ReadsPerSecond:  v.GetInt(cfgRateLimitReads),
+		Window:          v.GetDuration(cfgRateLimitWindow),
+		WritesPerWindow: v.GetInt(cfgRateLimitWrites),
+		NodesPerWindow:  v.GetInt(cfgRateLimitNodes),
+	}))
+	httpSrv := http.New(v.GetString(cfgListenAddr), storage, httpOpts...)
 	ctx, cancel := signal.NotifyContext(context.Background(),
 		syscall.SIGTERM, syscall.SIGINT)
 	defer cancel()
@@ -82,9 +256,16 @@ func main() {
 		<-ctx.Done()
 		closeWithErrLog(httpSrv, 10*time.Second)
 	}()
+	if syncer := setupSyncer(v, storage); syncer != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			syncer.Run(ctx)
+		}()
+	}
 
 	log.Infof("Start listening on %v", v.GetString(cfgListenAddr))
-	err = httpSrv.Run()
+	err := httpSrv.Run()
 	if err != nil {
 		log.Errorw(err.Error(), zap.Error(err))
 	}
@@ -93,6 +274,154 @@ func main() {
 	log.Infof("Bye")
 }
 
+// storages opened according to cfgStorage
+type storages struct {
+	nodes       hashdb.Storage
+	states      hashdb.StateRegistry
+	submissions hashdb.SubmissionLog
+	// metadata of nodes, set by all built-in storages
+	nodeMeta hashdb.NodeMetaGetter
+	close    func()
+	// nil unless storage is PostgreSQL
+	pg *pgxpool.Pool
+}
+
+// setupStorage opens storages configured by cfgStorage
+func setupStorage(v *viper.Viper) storages {
+	s := openStorage(v)
+	if v.GetBool(cfgStrictNodes) {
+		s.nodes = hashdb.NewStrict(s.nodes)
+	}
+	return s
+}
+
+func openStorage(v *viper.Viper) storages {
+	switch v.GetString(cfgStorage) {
+	case storagePostgres:
+		conn := setupPgPool(v)
+
+		err := conn.Ping(context.Background())
+		if err != nil {
+			log.Warnf("database error, start without database connection: %+v",
+				errors.WithStack(err))
+			if v.GetBool(cfgAutoMigrate) {
+				log.Warnf("database is unreachable, skip migrations")
+			}
+		} else if v.GetBool(cfgAutoMigrate) {
+			migrateDB(conn)
+		}
+
+		metrics.RegisterPgxPool(conn)
+		nodes := hashdb.New(conn)
+		return storages{
+			nodes:       nodes,
+			states:      hashdb.NewStateRegistry(conn),
+			submissions: hashdb.NewSubmissionLog(conn),
+			nodeMeta:    nodes.(hashdb.NodeMetaGetter),
+			pg:          conn,
+			close:       conn.Close,
+		}
+	case storageBolt:
+		db, err := bbolt.Open(v.GetString(cfgBoltPath), 0600,
+			&bbolt.Options{Timeout: 10 * time.Second})
+		if err != nil {
+			panic(err)
+		}
+
+		storage, err := hashdb.NewBolt(db)
+		if err != nil {
+			panic(fmt.Sprintf("%+v", err))
+		}
+		states, err := hashdb.NewBoltStateRegistry(db)
+		if err != nil {
+			panic(fmt.Sprintf("%+v", err))
+		}
+		submissions, err := hashdb.NewBoltSubmissionLog(db)
+		if err != nil {
+			panic(fmt.Sprintf("%+v", err))
+		}
+
+		closeDB := func() {
+			if err := db.Close(); err != nil {
+				log.Errorf("%+v", errors.WithStack(err))
+			}
+		}
+		return storages{
+			nodes:       storage,
+			states:      states,
+			submissions: submissions,
+			nodeMeta:    storage.(hashdb.NodeMetaGetter),
+			close:       closeDB,
+		}
+	default:
+		panic(fmt.Sprintf("unsupported storage type: %v",
+			v.GetString(cfgStorage)))
+	}
+}
+
+// setupSyncer returns nil if replication from upstream is not configured
+func setupSyncer(v *viper.Viper, storage hashdb.Storage) *upstream.Syncer {
+	url := v.GetString(cfgUpstreamURL)
+	if url == "" {
+		return nil
+	}
+	roots, err := parseRoots(splitList(v.GetString(cfgUpstreamRoots)))
+	if err != nil {
+		panic(err)
+	}
+	if len(roots) == 0 {
+		panic(fmt.Sprintf("%v is set, but %v is empty", cfgUpstreamURL,
+			cfgUpstreamRoots))
+	}
+	log.Infof("Replicating %v trees from %v", len(roots), url)
+	return upstream.NewSyncer(storage, upstream.NewClient(url), roots,
+		v.GetDuration(cfgUpstreamSyncInterval))
+}
+
+// setupAPIKeys returns nil if API keys are not configured
+func setupAPIKeys(v *viper.Viper, s storages) auth.Keys {
+	var keys []auth.Keys
+	if cfgKeys := v.GetString(cfgAPIKeys); cfgKeys != "" {
+		k, err := auth.ParseKeys(cfgKeys)
+		if err != nil {
+			panic(err)
+		}
+		keys = append(keys, k)
+	}
+	if v.GetBool(cfgAPIKeysDB) {
+		if s.pg == nil {
+			panic(fmt.Sprintf("%v requires %v storage", cfgAPIKeysDB,
+				storagePostgres))
+		}
+		keys = append(keys, auth.NewPgKeys(s.pg))
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return auth.Chain(keys...)
+}
+
+// splitList splits a config value separated by commas or spaces
+func splitList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+func setupPgPool(v *viper.Viper) *pgxpool.Pool {
+	pxpoolConfig, err := pgxpool.ParseConfig(v.GetString(cfgDb))
+	if err != nil {
+		panic(err)
+	}
+	pxpoolConfig.LazyConnect = true
+
+	conn, err := pgxpool.ConnectConfig(context.Background(), pxpoolConfig)
+	if err != nil {
+		panic(err)
+	}
+	return conn
+}
+
 type ctxCloser interface {
 	Close(context.Context) error
 }
@@ -0,0 +1,242 @@
+// Package metrics collects Prometheus metrics of the service.
+package metrics
+
+import (
+	"context"
+	stderr "errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/reverse-hash-service/hashdb"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "rhs"
+
+var registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by route, method and code.",
+		},
+		[]string{"route", "method", "code"})
+	httpDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by route and method.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"route", "method"})
+	nodesSaved = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "nodes_saved_total",
+			Help: "Number of submitted nodes by result: " +
+				"inserted or deduplicated.",
+		},
+		[]string{"result"})
+	nodesLookups = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "node_lookups_total",
+			Help:      "Number of node lookups by result: hit or miss.",
+		},
+		[]string{"result"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration, nodesSaved, nodesLookups)
+}
+
+// Handler serves metrics in Prometheus format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Middleware counts requests and measures latency by chi route pattern. It
+// should be installed with chi.Router.Use, so the route is known when
+// request is finished.
+func Middleware(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		t1 := time.Now()
+		next.ServeHTTP(ww, r)
+
+		route := "unknown"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil &&
+			rctx.RoutePattern() != "" {
+
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		httpRequests.
+			WithLabelValues(route, r.Method, strconv.Itoa(status)).Inc()
+		httpDuration.WithLabelValues(route, r.Method).
+			Observe(time.Since(t1).Seconds())
+	}
+	return http.HandlerFunc(fn)
+}
+
+// storage counts saved nodes and lookups
+type storage struct {
+	hashdb.Storage
+}
+
+// NewStorage wraps storage to collect metrics of saved and requested nodes
+func NewStorage(s hashdb.Storage) hashdb.Storage {
+	return &storage{s}
+}
+
+func (s *storage) SaveNodes(ctx context.Context,
+	nodes []hashdb.Node) ([]merkletree.Hash, error) {
+
+	inserted, err := s.Storage.SaveNodes(ctx, nodes)
+	if err != nil {
+		return inserted, err
+	}
+	nodesSaved.WithLabelValues("inserted").Add(float64(len(inserted)))
+	nodesSaved.WithLabelValues("deduplicated").
+		Add(float64(len(nodes) - len(inserted)))
+	return inserted, nil
+}
+
+func (s *storage) ByHash(ctx context.Context,
+	hash merkletree.Hash) (hashdb.Node, error) {
+
+	n, err := s.Storage.ByHash(ctx, hash)
+	switch {
+	case err == nil:
+		nodesLookups.WithLabelValues("hit").Inc()
+	case stderr.Is(err, hashdb.ErrDoesNotExists):
+		nodesLookups.WithLabelValues("miss").Inc()
+	}
+	return n, err
+}
+
+func (s *storage) ByHashes(ctx context.Context,
+	hashes []merkletree.Hash) ([]hashdb.Node, error) {
+
+	nodes, err := s.Storage.ByHashes(ctx, hashes)
+	if err != nil {
+		return nodes, err
+	}
+	uniqHashes := make(map[merkletree.Hash]struct{}, len(hashes))
+	for _, h := range hashes {
+		uniqHashes[h] = struct{}{}
+	}
+	nodesLookups.WithLabelValues("hit").Add(float64(len(nodes)))
+	nodesLookups.WithLabelValues("miss").
+		Add(float64(len(uniqHashes) - len(nodes)))
+	return nodes, nil
+}
+
+// RegisterCache exposes counters of the in-process nodes cache
+func RegisterCache(c *hashdb.CachedStorage) {
+	registry.MustRegister(
+		prometheus.NewCounterFunc(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "cache_hits_total",
+				Help:      "Number of node lookups served from cache.",
+			},
+			func() float64 { return float64(c.Stats().Hits) }),
+		prometheus.NewCounterFunc(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "cache_misses_total",
+				Help:      "Number of node lookups not found in cache.",
+			},
+			func() float64 { return float64(c.Stats().Misses) }),
+		prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "cache_entries",
+				Help:      "Number of entries in cache.",
+			},
+			func() float64 { return float64(c.Stats().Len) }))
+}
+
+// RegisterPgxPool exposes statistics of the database connection pool
+func RegisterPgxPool(pool *pgxpool.Pool) {
+	registry.MustRegister(&pgxPoolCollector{pool})
+}
+
+var (
+	pgxAcquiredConns = prometheus.NewDesc(
+		namespace+"_pgxpool_acquired_conns",
+		"Number of currently acquired connections in the pool.", nil, nil)
+	pgxIdleConns = prometheus.NewDesc(
+		namespace+"_pgxpool_idle_conns",
+		"Number of currently idle connections in the pool.", nil, nil)
+	pgxTotalConns = prometheus.NewDesc(
+		namespace+"_pgxpool_total_conns",
+		"Total number of connections currently in the pool.", nil, nil)
+	pgxMaxConns = prometheus.NewDesc(
+		namespace+"_pgxpool_max_conns",
+		"Maximum size of the pool.", nil, nil)
+	pgxAcquireCount = prometheus.NewDesc(
+		namespace+"_pgxpool_acquire_count_total",
+		"Number of successful connection acquires from the pool.", nil, nil)
+	pgxAcquireDuration = prometheus.NewDesc(
+		namespace+"_pgxpool_acquire_duration_seconds_total",
+		"Total duration of all successful acquires from the pool.", nil, nil)
+	pgxEmptyAcquireCount = prometheus.NewDesc(
+		namespace+"_pgxpool_empty_acquire_count_total",
+		"Number of acquires that waited for a connection because "+
+			"the pool was empty.", nil, nil)
+	pgxCanceledAcquireCount = prometheus.NewDesc(
+		namespace+"_pgxpool_canceled_acquire_count_total",
+		"Number of acquires canceled by a context.", nil, nil)
+)
+
+type pgxPoolCollector struct {
+	pool *pgxpool.Pool
+}
+
+func (c *pgxPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pgxAcquiredConns
+	ch <- pgxIdleConns
+	ch <- pgxTotalConns
+	ch <- pgxMaxConns
+	ch <- pgxAcquireCount
+	ch <- pgxAcquireDuration
+	ch <- pgxEmptyAcquireCount
+	ch <- pgxCanceledAcquireCount
+}
+
+func (c *pgxPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	st := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(pgxAcquiredConns,
+		prometheus.GaugeValue, float64(st.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(pgxIdleConns,
+		prometheus.GaugeValue, float64(st.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(pgxTotalConns,
+		prometheus.GaugeValue, float64(st.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(pgxMaxConns,
+		prometheus.GaugeValue, float64(st.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(pgxAcquireCount,
+		prometheus.CounterValue, float64(st.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(pgxAcquireDuration,
+		prometheus.CounterValue, st.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(pgxEmptyAcquireCount,
+		prometheus.CounterValue, float64(st.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(pgxCanceledAcquireCount,
+		prometheus.CounterValue, float64(st.CanceledAcquireCount()))
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/reverse-hash-service/hashdb"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/node/{hash}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	counter := httpRequests.WithLabelValues("/node/{hash}", "GET", "404")
+	before := testutil.ToFloat64(counter)
+	for _, h := range []string{"1", "2"} {
+		req := httptest.NewRequest(http.MethodGet, "/node/"+h, http.NoBody)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	require.Equal(t, before+2, testutil.ToFloat64(counter))
+}
+
+func TestStorage(t *testing.T) {
+	ctx := context.Background()
+	s := NewStorage(hashdb.NewMemory())
+
+	var n hashdb.Node
+	err := n.UnmarshalJSON([]byte(`{
+  "hash":"658c7a65594ebb0815e1cc20f54284ccdb51bb1625f103c116ce58444145381e",
+  "children":[
+    "037c4d7bbb0407b8000000000000000000000000000000000000000000000000",
+    "0000000000000000000000000000000000000000000000000000000000000000",
+    "0100000000000000000000000000000000000000000000000000000000000000"
+  ]
+}`))
+	require.NoError(t, err)
+
+	inserted := nodesSaved.WithLabelValues("inserted")
+	deduplicated := nodesSaved.WithLabelValues("deduplicated")
+	hit := nodesLookups.WithLabelValues("hit")
+	miss := nodesLookups.WithLabelValues("miss")
+	insertedBefore := testutil.ToFloat64(inserted)
+	deduplicatedBefore := testutil.ToFloat64(deduplicated)
+	hitBefore := testutil.ToFloat64(hit)
+	missBefore := testutil.ToFloat64(miss)
+
+	_, err = s.SaveNodes(ctx, []hashdb.Node{n})
+	require.NoError(t, err)
+	_, err = s.SaveNodes(ctx, []hashdb.Node{n})
+	require.NoError(t, err)
+	require.Equal(t, insertedBefore+1, testutil.ToFloat64(inserted))
+	require.Equal(t, deduplicatedBefore+1, testutil.ToFloat64(deduplicated))
+
+	_, err = s.ByHash(ctx, n.Hash)
+	require.NoError(t, err)
+	_, err = s.ByHash(ctx, merkletree.HashZero)
+	require.ErrorIs(t, err, hashdb.ErrDoesNotExists)
+	_, err = s.ByHashes(ctx,
+		[]merkletree.Hash{n.Hash, merkletree.HashZero, merkletree.HashZero})
+	require.NoError(t, err)
+	require.Equal(t, hitBefore+2, testutil.ToFloat64(hit))
+	require.Equal(t, missBefore+2, testutil.ToFloat64(miss))
+}
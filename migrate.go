@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/iden3/reverse-hash-service/log"
+	"github.com/iden3/reverse-hash-service/migrations"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/spf13/viper"
+)
+
+func migrate(v *viper.Viper) {
+	conn := setupPgPool(v)
+	defer conn.Close()
+	migrateDB(conn)
+}
+
+func migrateDB(conn *pgxpool.Pool) {
+	applied, err := migrations.Up(context.Background(), conn)
+	if err != nil {
+		panic(fmt.Sprintf("%+v", err))
+	}
+	if len(applied) == 0 {
+		log.Infof("Database schema is up to date")
+	} else {
+		log.Infof("Applied database migrations: %v", applied)
+	}
+}
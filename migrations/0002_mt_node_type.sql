@@ -0,0 +1,14 @@
+-- hashdb.NodeType: 0 - unknown, 1 - middle, 2 - leaf, 3 - state
+ALTER TABLE mt_node ADD COLUMN IF NOT EXISTS type SMALLINT NOT NULL DEFAULT 0;
+
+UPDATE mt_node SET type = CASE
+    WHEN cardinality(children) = 2 THEN 1
+    WHEN cardinality(children) = 3 AND children[3] =
+        '\x0100000000000000000000000000000000000000000000000000000000000000'::bytea
+        THEN 2
+    WHEN cardinality(children) = 3 THEN 3
+    ELSE 0
+END
+WHERE type = 0;
+
+CREATE INDEX IF NOT EXISTS mt_node_type_idx ON mt_node (type);
@@ -0,0 +1,5 @@
+-- time the node was saved first, NULL for nodes saved before this migration
+ALTER TABLE mt_node ADD COLUMN IF NOT EXISTS first_seen_at TIMESTAMPTZ;
+-- the default is set separately, so existing rows are not backfilled with
+-- the time of the migration
+ALTER TABLE mt_node ALTER COLUMN first_seen_at SET DEFAULT now();
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS identity_state (
+    id BIGSERIAL PRIMARY KEY,
+    identity TEXT NOT NULL,
+    state BYTEA NOT NULL CHECK (length(state) = 32),
+    published_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS identity_state_identity_idx
+    ON identity_state (identity, id);
+
+-- a state can be published once per identity, so an old state can't become
+-- the latest one again
+CREATE UNIQUE INDEX IF NOT EXISTS identity_state_state_idx
+    ON identity_state (identity, state);
@@ -0,0 +1,15 @@
+-- name of the API key that submitted the node first
+ALTER TABLE mt_node ADD COLUMN IF NOT EXISTS submitter TEXT;
+
+CREATE TABLE IF NOT EXISTS api_key (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    -- SHA-256 of the key, keys themselves are not stored
+    key_hash BYTEA NOT NULL UNIQUE CHECK (length(key_hash) = 32),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ
+);
+
+-- only one active key per name, so keys can be rotated
+CREATE UNIQUE INDEX IF NOT EXISTS api_key_name_idx ON api_key (name)
+    WHERE revoked_at IS NULL;
@@ -0,0 +1,2 @@
+-- iden3 identity that signed the submission of the node first
+ALTER TABLE mt_node ADD COLUMN IF NOT EXISTS submitter_identity TEXT;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS node_submission (
+    id BIGSERIAL PRIMARY KEY,
+    -- ID of the HTTP request from the X-Request-Id header or generated
+    request_id TEXT NOT NULL,
+    -- name of the API key or the identity that signed the submission
+    submitter TEXT,
+    submitter_identity TEXT,
+    submitted_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- number of submitted nodes
+    nodes INTEGER NOT NULL,
+    -- number of submitted nodes new to mt_node
+    inserted INTEGER NOT NULL,
+    -- hashes of inserted nodes
+    hashes BYTEA[] NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS node_submission_submitted_at_idx
+    ON node_submission (submitted_at);
+CREATE INDEX IF NOT EXISTS node_submission_hashes_idx
+    ON node_submission USING GIN (hashes);
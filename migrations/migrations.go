@@ -0,0 +1,153 @@
+// Package migrations keeps versioned database schema changes. Applied
+// versions are tracked in the schema_migrations table.
+//
+// Each migration is a NNNN_description.sql file in this directory, where NNNN
+// is a version number. Migrations should be idempotent (use IF NOT EXISTS
+// and similar), so databases created from schema.sql can be migrated too.
+// Keep schema.sql in sync with migrations.
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+)
+
+//go:embed *.sql
+var migrationFiles embed.FS
+
+const tableMigrations = "schema_migrations"
+
+// random number to serialize concurrent migrations from different instances
+const advisoryLockID = 7_382_104_551
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+type dbI interface {
+	BeginFunc(ctx context.Context, f func(pgx.Tx) error) error
+}
+
+// Up applies all migrations that were not applied yet. Returns versions of
+// applied migrations.
+func Up(ctx context.Context, db dbI) ([]int, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []int
+	err = db.BeginFunc(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`,
+			advisoryLockID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		_, err = tx.Exec(ctx, fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %[1]v (
+    version INT PRIMARY KEY,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`, quote(tableMigrations)))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		done, err := appliedVersions(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if done[m.version] {
+				continue
+			}
+			_, err = tx.Exec(ctx, m.sql)
+			if err != nil {
+				return errors.Wrapf(err, "migration %v failed", m.name)
+			}
+			_, err = tx.Exec(ctx, fmt.Sprintf(
+				`INSERT INTO %[1]v (version) VALUES ($1)`,
+				quote(tableMigrations)), m.version)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			applied = append(applied, m.version)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+func appliedVersions(ctx context.Context, tx pgx.Tx) (map[int]bool, error) {
+	rows, err := tx.Query(ctx,
+		fmt.Sprintf(`SELECT version FROM %[1]v`, quote(tableMigrations)))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var versions = make(map[int]bool)
+	for rows.Next() {
+		var v int
+		if err = rows.Scan(&v); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		versions[v] = true
+	}
+	return versions, errors.WithStack(rows.Err())
+}
+
+func loadMigrations() ([]migration, error) {
+	entries, err := migrationFiles.ReadDir(".")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var migrations []migration
+	var versions = make(map[int]string)
+	for _, e := range entries {
+		name := e.Name()
+		versionStr, _, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, errors.Errorf("invalid migration file name: %v", name)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, errors.Errorf("invalid migration version: %v", name)
+		}
+		if prev, ok := versions[version]; ok {
+			return nil, errors.Errorf("duplicate migration version: %v, %v",
+				prev, name)
+		}
+		versions[version] = name
+
+		data, err := migrationFiles.ReadFile(name)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		migrations = append(migrations,
+			migration{version: version, name: name, sql: string(data)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
+
+func quote(identifier string) string {
+	return pgx.Identifier{identifier}.Sanitize()
+}
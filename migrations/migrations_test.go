@@ -0,0 +1,97 @@
+package migrations
+
+import (
+	"context"
+	"testing"
+
+	go_test_pg "github.com/olomix/go-test-pg"
+	"github.com/stretchr/testify/require"
+)
+
+var dbtest = go_test_pg.Pgpool{
+	BaseName: "rhs_migrations",
+	Skip:     false,
+}
+
+var dbtestSchema = go_test_pg.Pgpool{
+	BaseName:   "rhs",
+	SchemaFile: "../schema.sql",
+	Skip:       false,
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	for i := range migrations {
+		require.Equal(t, i+1, migrations[i].version, migrations[i].name)
+		require.NotEmpty(t, migrations[i].sql)
+	}
+}
+
+func TestUp(t *testing.T) {
+	migrations, err := loadMigrations()
+	require.NoError(t, err)
+	var allVersions []int
+	for _, m := range migrations {
+		allVersions = append(allVersions, m.version)
+	}
+
+	db := dbtest.WithEmpty(t)
+	ctx := context.Background()
+	applied, err := Up(ctx, db)
+	require.NoError(t, err)
+	require.Equal(t, allVersions, applied)
+
+	applied, err = Up(ctx, db)
+	require.NoError(t, err)
+	require.Empty(t, applied)
+
+	var n int
+	err = db.QueryRow(ctx, "SELECT count(*) FROM mt_node").Scan(&n)
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+}
+
+// migrations can be applied to database created from schema.sql
+func TestUp_SchemaFile(t *testing.T) {
+	db := dbtestSchema.WithEmpty(t)
+	_, err := Up(context.Background(), db)
+	require.NoError(t, err)
+}
+
+func TestUp_NodeTypeBackfill(t *testing.T) {
+	migrations, err := loadMigrations()
+	require.NoError(t, err)
+
+	db := dbtest.WithEmpty(t)
+	ctx := context.Background()
+	// database created before node types were introduced
+	_, err = db.Exec(ctx, migrations[0].sql)
+	require.NoError(t, err)
+	_, err = db.Exec(ctx, `
+INSERT INTO mt_node (hash, children) VALUES
+  (decode(repeat('01', 32), 'hex'), ARRAY['\x02'::bytea, '\x03'::bytea]),
+  (decode(repeat('04', 32), 'hex'), ARRAY['\x05'::bytea, '\x06'::bytea,
+    '\x0100000000000000000000000000000000000000000000000000000000000000'::bytea]),
+  (decode(repeat('07', 32), 'hex'),
+    ARRAY['\x08'::bytea, '\x09'::bytea, '\x0a'::bytea])`)
+	require.NoError(t, err)
+
+	_, err = Up(ctx, db)
+	require.NoError(t, err)
+
+	rows, err := db.Query(ctx,
+		`SELECT substr(encode(hash, 'hex'), 1, 2), type FROM mt_node`)
+	require.NoError(t, err)
+	defer rows.Close()
+	got := map[string]int16{}
+	for rows.Next() {
+		var h string
+		var typ int16
+		require.NoError(t, rows.Scan(&h, &typ))
+		got[h] = typ
+	}
+	require.NoError(t, rows.Err())
+	require.Equal(t, map[string]int16{"01": 1, "04": 2, "07": 3}, got)
+}
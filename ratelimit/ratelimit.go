@@ -0,0 +1,103 @@
+// Package ratelimit limits rates of requests and submitted nodes per client.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// how often buckets that are full again are forgotten
+const cleanupInterval = time.Minute
+
+// Limiter is a set of token buckets, one per client key. A bucket holds at
+// most burst tokens and is refilled at rate tokens per second.
+type Limiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu          sync.Mutex
+	buckets     map[string]*bucket
+	lastCleanup time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New creates a limiter that allows limit tokens per window with bursts of up
+// to limit tokens.
+func New(limit int, window time.Duration) *Limiter {
+	return &Limiter{
+		rate:    float64(limit) / window.Seconds(),
+		burst:   float64(limit),
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Burst is the maximum number of tokens a bucket holds.
+func (l *Limiter) Burst() int {
+	return int(l.burst)
+}
+
+// Allow takes n tokens from the bucket of key. If there are not enough
+// tokens, nothing is taken, and Allow returns false and the time after which
+// the request may be retried. Requests of more than Burst tokens are never
+// allowed and get zero time, callers should reject them before.
+func (l *Limiter) Allow(key string, n int) (bool, time.Duration) {
+	if float64(n) > l.burst {
+		return false, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.cleanup(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst,
+		b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	need := float64(n)
+	if b.tokens < need {
+		wait := time.Duration((need - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens -= float64(n)
+	return true, 0
+}
+
+// Return gives back n tokens taken from the bucket of key by Allow, e.g.
+// when the request turns out to belong to another client.
+func (l *Limiter) Return(key string, n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// a forgotten bucket is full already
+	if b, ok := l.buckets[key]; ok {
+		b.tokens = math.Min(l.burst, b.tokens+float64(n))
+	}
+}
+
+// cleanup forgets buckets that are full again, they are the same as new
+// ones
+func (l *Limiter) cleanup(now time.Time) {
+	if now.Sub(l.lastCleanup) < cleanupInterval {
+		return
+	}
+	l.lastCleanup = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
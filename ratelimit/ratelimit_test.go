@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New(10, time.Second)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 10; i++ {
+		ok, _ := l.Allow("alice", 1)
+		require.True(t, ok)
+	}
+	ok, wait := l.Allow("alice", 1)
+	require.False(t, ok)
+	require.Equal(t, 100*time.Millisecond, wait)
+
+	// other keys have their own buckets
+	ok, _ = l.Allow("bob", 10)
+	require.True(t, ok)
+
+	now = now.Add(200 * time.Millisecond)
+	ok, _ = l.Allow("alice", 2)
+	require.True(t, ok)
+	ok, _ = l.Allow("alice", 1)
+	require.False(t, ok)
+}
+
+func TestLimiter_OverBurst(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New(10, time.Minute)
+	l.now = func() time.Time { return now }
+	require.Equal(t, 10, l.Burst())
+
+	// more than burst is never allowed, even from a full bucket
+	ok, wait := l.Allow("alice", 11)
+	require.False(t, ok)
+	require.Zero(t, wait)
+
+	// and takes nothing
+	ok, _ = l.Allow("alice", 10)
+	require.True(t, ok)
+}
+
+func TestLimiter_Cleanup(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New(10, time.Second)
+	l.now = func() time.Time { return now }
+
+	l.Allow("alice", 10)
+	now = now.Add(500 * time.Millisecond)
+	l.Allow("bob", 10)
+	require.Len(t, l.buckets, 2)
+
+	now = now.Add(cleanupInterval)
+	l.Allow("carol", 1)
+	require.Len(t, l.buckets, 1)
+}
+
+func TestLimiter_Return(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New(2, time.Minute)
+	l.now = func() time.Time { return now }
+
+	ok, _ := l.Allow("alice", 2)
+	require.True(t, ok)
+	l.Return("alice", 1)
+	ok, _ = l.Allow("alice", 1)
+	require.True(t, ok)
+	ok, _ = l.Allow("alice", 1)
+	require.False(t, ok)
+
+	// the bucket is never fuller than burst
+	l.Return("alice", 5)
+	ok, _ = l.Allow("alice", 2)
+	require.True(t, ok)
+	ok, _ = l.Allow("alice", 1)
+	require.False(t, ok)
+
+	// unknown keys are ignored
+	l.Return("bob", 1)
+	require.Len(t, l.buckets, 1)
+}
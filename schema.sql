@@ -1,5 +1,63 @@
 CREATE TABLE mt_node (
     id BIGSERIAL PRIMARY KEY,
     hash BYTEA NOT NULL UNIQUE CHECK (length(hash) = 32),
-    children BYTEA[]
+    children BYTEA[],
+    -- hashdb.NodeType: 0 - unknown, 1 - middle, 2 - leaf, 3 - state
+    type SMALLINT NOT NULL DEFAULT 0,
+    -- time the node was saved first, NULL for nodes saved before it was
+    -- recorded
+    first_seen_at TIMESTAMPTZ DEFAULT now(),
+    -- name of the API key that submitted the node first
+    submitter TEXT,
+    -- iden3 identity that signed the submission of the node first
+    submitter_identity TEXT
 );
+
+CREATE INDEX mt_node_type_idx ON mt_node (type);
+
+CREATE TABLE identity_state (
+    id BIGSERIAL PRIMARY KEY,
+    identity TEXT NOT NULL,
+    state BYTEA NOT NULL CHECK (length(state) = 32),
+    published_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX identity_state_identity_idx ON identity_state (identity, id);
+
+-- a state can be published once per identity
+CREATE UNIQUE INDEX identity_state_state_idx
+    ON identity_state (identity, state);
+
+CREATE TABLE api_key (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    -- SHA-256 of the key, keys themselves are not stored
+    key_hash BYTEA NOT NULL UNIQUE CHECK (length(key_hash) = 32),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ
+);
+
+-- only one active key per name, so keys can be rotated
+CREATE UNIQUE INDEX api_key_name_idx ON api_key (name)
+    WHERE revoked_at IS NULL;
+
+CREATE TABLE node_submission (
+    id BIGSERIAL PRIMARY KEY,
+    -- ID of the HTTP request from the X-Request-Id header or generated
+    request_id TEXT NOT NULL,
+    -- name of the API key or the identity that signed the submission
+    submitter TEXT,
+    submitter_identity TEXT,
+    submitted_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- number of submitted nodes
+    nodes INTEGER NOT NULL,
+    -- number of submitted nodes new to mt_node
+    inserted INTEGER NOT NULL,
+    -- hashes of inserted nodes
+    hashes BYTEA[] NOT NULL
+);
+
+CREATE INDEX node_submission_submitted_at_idx
+    ON node_submission (submitted_at);
+CREATE INDEX node_submission_hashes_idx
+    ON node_submission USING GIN (hashes);
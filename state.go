@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	stderr "errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/reverse-hash-service/hashdb"
+	"github.com/spf13/viper"
+)
+
+// publishState records a new latest state of identity. The state node must
+// be submitted before with POST /node.
+func publishState(v *viper.Viper, args []string) int {
+	if len(args) != 2 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	identity := args[0]
+	state, err := merkletree.NewHashFromHex(args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid state %v: %v\n", args[1], err)
+		return 2
+	}
+
+	s := setupStorage(v)
+	defer s.close()
+
+	ctx := context.Background()
+	node, err := s.nodes.ByHash(ctx, *state)
+	if stderr.Is(err, hashdb.ErrDoesNotExists) {
+		fmt.Fprintf(os.Stderr, "state node %v not found\n", state.Hex())
+		return 1
+	} else if err != nil {
+		panic(fmt.Sprintf("%+v", err))
+	}
+	if node.Type() != hashdb.NodeTypeState {
+		fmt.Fprintf(os.Stderr, "node %v is not an identity state\n",
+			state.Hex())
+		return 1
+	}
+
+	pub, err := s.states.PublishState(ctx, identity, *state)
+	if stderr.Is(err, hashdb.ErrStateExists) {
+		fmt.Fprintf(os.Stderr, "state %v is already registered\n",
+			state.Hex())
+		return 1
+	} else if err != nil {
+		panic(fmt.Sprintf("%+v", err))
+	}
+	fmt.Printf("%v: %v, published at %v\n", pub.Identity, pub.State.Hex(),
+		pub.PublishedAt.Format(time.RFC3339Nano))
+	return 0
+}
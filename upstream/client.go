@@ -0,0 +1,83 @@
+// Package upstream fetches nodes from another reverse hash service.
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/reverse-hash-service/hashdb"
+	"github.com/pkg/errors"
+)
+
+const defaultTimeout = 30 * time.Second
+
+// maximum size of a node response from upstream
+const maxResponseSize = 64 * 1024
+
+// Client gets nodes from an upstream RHS with GET /node/{hash}. Every node
+// is verified to have the requested hash, so upstream does not need to be
+// trusted.
+type Client struct {
+	url        string
+	httpClient *http.Client
+}
+
+// NewClient creates a client of RHS at url, e.g. https://rhs.example.com.
+func NewClient(url string) *Client {
+	return &Client{
+		url:        strings.TrimSuffix(url, "/"),
+		httpClient: &http.Client{Timeout: defaultTimeout},
+	}
+}
+
+// ByHash returns the node from upstream. If upstream does not have the node,
+// hashdb.ErrDoesNotExists is returned.
+func (c *Client) ByHash(ctx context.Context,
+	hash merkletree.Hash) (hashdb.Node, error) {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		c.url+"/node/"+hash.Hex(), http.NoBody)
+	if err != nil {
+		return hashdb.Node{}, errors.WithStack(err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return hashdb.Node{}, errors.WithStack(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return hashdb.Node{Hash: hash},
+			errors.WithStack(hashdb.ErrDoesNotExists)
+	default:
+		return hashdb.Node{}, errors.Errorf(
+			"unexpected upstream response status for node %v: %v",
+			hash.Hex(), resp.Status)
+	}
+
+	var nodeResp struct {
+		Node hashdb.Node `json:"node"`
+	}
+	// Node.UnmarshalJSON checks that the hash matches the children
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).
+		Decode(&nodeResp)
+	if err != nil {
+		return hashdb.Node{}, errors.Wrapf(err,
+			"invalid upstream response for node %v", hash.Hex())
+	}
+	if nodeResp.Node.Hash != hash {
+		return hashdb.Node{}, errors.Errorf(
+			"upstream returned node %v instead of %v",
+			nodeResp.Node.Hash.Hex(), hash.Hex())
+	}
+	return nodeResp.Node, nil
+}
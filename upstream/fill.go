@@ -0,0 +1,61 @@
+package upstream
+
+import (
+	"context"
+	stderr "errors"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/reverse-hash-service/hashdb"
+	"github.com/iden3/reverse-hash-service/log"
+)
+
+type fillStorage struct {
+	hashdb.Storage
+	remotes []*Client
+}
+
+// NewFillStorage wraps storage to fetch nodes not found locally from
+// upstreams, tried in order. A fetched node is verified by its hash and saved
+// to storage before it is returned, so storage fills itself with requested
+// nodes. Only ByHash falls back to upstreams.
+func NewFillStorage(storage hashdb.Storage,
+	remotes ...*Client) hashdb.Storage {
+
+	return &fillStorage{Storage: storage, remotes: remotes}
+}
+
+// ByHash returns hashdb.ErrDoesNotExists if no upstream has the node. If the
+// node is not found and some upstream failed, the upstream error is returned.
+func (s *fillStorage) ByHash(ctx context.Context,
+	hash merkletree.Hash) (hashdb.Node, error) {
+
+	node, err := s.Storage.ByHash(ctx, hash)
+	if !stderr.Is(err, hashdb.ErrDoesNotExists) {
+		return node, err
+	}
+
+	notFoundErr := err
+	var upstreamErr error
+	for _, r := range s.remotes {
+		node, err = r.ByHash(ctx, hash)
+		if stderr.Is(err, hashdb.ErrDoesNotExists) {
+			continue
+		} else if err != nil {
+			log.Warnf("error getting node %v from upstream: %v",
+				hash.Hex(), err)
+			upstreamErr = err
+			continue
+		}
+
+		_, err = s.Storage.SaveNodes(ctx, []hashdb.Node{node})
+		if err != nil {
+			return hashdb.Node{}, err
+		}
+		return node, nil
+	}
+
+	if upstreamErr != nil {
+		return hashdb.Node{}, upstreamErr
+	}
+	return hashdb.Node{Hash: hash}, notFoundErr
+}
@@ -0,0 +1,64 @@
+package upstream
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/reverse-hash-service/hashdb"
+	rhshttp "github.com/iden3/reverse-hash-service/http"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFillStorage(t *testing.T) {
+	ctx := context.Background()
+	nodes := treeNodes(t, newTree(t, 1, 3, 5))
+
+	emptySrv := httptest.NewServer(rhshttp.Handler(hashdb.NewMemory()))
+	defer emptySrv.Close()
+	remoteStorage := hashdb.NewMemory()
+	_, err := remoteStorage.SaveNodes(ctx, nodes[1:])
+	require.NoError(t, err)
+	srv := httptest.NewServer(rhshttp.Handler(remoteStorage))
+	defer srv.Close()
+
+	local := hashdb.NewMemory()
+	_, err = local.SaveNodes(ctx, nodes[:1])
+	require.NoError(t, err)
+	storage := NewFillStorage(local, NewClient(emptySrv.URL),
+		NewClient(srv.URL))
+
+	// found locally
+	n, err := storage.ByHash(ctx, nodes[0].Hash)
+	require.NoError(t, err)
+	require.Equal(t, nodes[0], n)
+
+	// found in the second upstream and saved locally
+	n, err = storage.ByHash(ctx, nodes[1].Hash)
+	require.NoError(t, err)
+	require.Equal(t, nodes[1], n)
+	n, err = local.ByHash(ctx, nodes[1].Hash)
+	require.NoError(t, err)
+	require.Equal(t, nodes[1], n)
+
+	// found nowhere
+	missing := *newTree(t, 2).Root()
+	_, err = storage.ByHash(ctx, missing)
+	require.ErrorIs(t, err, hashdb.ErrDoesNotExists)
+}
+
+func TestFillStorage_UpstreamError(t *testing.T) {
+	ctx := context.Background()
+	failingSrv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+	defer failingSrv.Close()
+
+	storage := NewFillStorage(hashdb.NewMemory(), NewClient(failingSrv.URL))
+	_, err := storage.ByHash(ctx, merkletree.Hash{1})
+	require.Error(t, err)
+	require.NotErrorIs(t, err, hashdb.ErrDoesNotExists)
+}
@@ -0,0 +1,209 @@
+package upstream
+
+import (
+	"context"
+	stderr "errors"
+	"sync"
+	"time"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/reverse-hash-service/hashdb"
+	"github.com/iden3/reverse-hash-service/log"
+	"go.uber.org/zap"
+)
+
+const (
+	// number of nodes looked up in local storage at once
+	syncBatchSize = 1000
+	// number of concurrent requests to upstream
+	fetchConcurrency = 8
+)
+
+type nodeGetter interface {
+	ByHash(ctx context.Context, hash merkletree.Hash) (hashdb.Node, error)
+}
+
+type localStorage interface {
+	SaveNodes(ctx context.Context,
+		nodes []hashdb.Node) ([]merkletree.Hash, error)
+	ByHashes(ctx context.Context,
+		hashes []merkletree.Hash) ([]hashdb.Node, error)
+}
+
+// SyncResult is a summary of Sync.
+type SyncResult struct {
+	// number of tree nodes found locally or fetched from upstream
+	Nodes int
+	// number of nodes fetched from upstream
+	Fetched int
+	// nodes found neither locally nor upstream
+	Missing []merkletree.Hash
+}
+
+// Sync fetches nodes of trees with given roots that are missing from local
+// storage. Roots may be tree roots or identity states, for states all three
+// trees are synced. Trees are walked completely, because a locally stored
+// node does not mean that its subtree is stored too. Nodes missing upstream
+// are skipped and listed in the result.
+func Sync(ctx context.Context, local localStorage, remote nodeGetter,
+	roots []merkletree.Hash) (SyncResult, error) {
+
+	var res SyncResult
+	visited := make(map[merkletree.Hash]struct{})
+	var queue []merkletree.Hash
+	enqueue := func(h merkletree.Hash) {
+		if h == merkletree.HashZero {
+			return
+		}
+		if _, ok := visited[h]; ok {
+			return
+		}
+		visited[h] = struct{}{}
+		queue = append(queue, h)
+	}
+	for _, r := range roots {
+		enqueue(r)
+	}
+
+	for len(queue) != 0 {
+		batch := queue
+		if len(batch) > syncBatchSize {
+			batch = batch[:syncBatchSize]
+		}
+		queue = queue[len(batch):]
+
+		nodes, err := local.ByHashes(ctx, batch)
+		if err != nil {
+			return res, err
+		}
+		found := make(map[merkletree.Hash]struct{}, len(nodes))
+		for i := range nodes {
+			found[nodes[i].Hash] = struct{}{}
+		}
+		var toFetch []merkletree.Hash
+		for _, h := range batch {
+			if _, ok := found[h]; !ok {
+				toFetch = append(toFetch, h)
+			}
+		}
+
+		fetched, missing, err := fetchNodes(ctx, remote, toFetch)
+		if err != nil {
+			return res, err
+		}
+		if len(fetched) != 0 {
+			_, err = local.SaveNodes(ctx, fetched)
+			if err != nil {
+				return res, err
+			}
+		}
+		res.Fetched += len(fetched)
+		res.Missing = append(res.Missing, missing...)
+
+		nodes = append(nodes, fetched...)
+		res.Nodes += len(nodes)
+		for i := range nodes {
+			switch nodes[i].Type() {
+			case hashdb.NodeTypeMiddle, hashdb.NodeTypeState:
+				for _, c := range nodes[i].Children {
+					enqueue(c)
+				}
+			}
+		}
+	}
+	return res, nil
+}
+
+// fetchNodes gets nodes from upstream concurrently. Hashes not found
+// upstream are returned in missing.
+func fetchNodes(ctx context.Context, remote nodeGetter,
+	hashes []merkletree.Hash) (nodes []hashdb.Node,
+	missing []merkletree.Hash, err error) {
+
+	type result struct {
+		node hashdb.Node
+		err  error
+	}
+	results := make([]result, len(hashes))
+	sem := make(chan struct{}, fetchConcurrency)
+	var wg sync.WaitGroup
+	for i := range hashes {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i].node, results[i].err = remote.ByHash(ctx, hashes[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range results {
+		switch {
+		case results[i].err == nil:
+			nodes = append(nodes, results[i].node)
+		case stderr.Is(results[i].err, hashdb.ErrDoesNotExists):
+			missing = append(missing, hashes[i])
+		default:
+			return nil, nil, results[i].err
+		}
+	}
+	return nodes, missing, nil
+}
+
+// Syncer periodically syncs trees from upstream.
+type Syncer struct {
+	local    localStorage
+	remote   nodeGetter
+	roots    []merkletree.Hash
+	interval time.Duration
+}
+
+// NewSyncer creates a Syncer of trees with given roots. If interval is zero,
+// trees are synced once.
+func NewSyncer(local localStorage, remote nodeGetter,
+	roots []merkletree.Hash, interval time.Duration) *Syncer {
+
+	return &Syncer{
+		local:    local,
+		remote:   remote,
+		roots:    roots,
+		interval: interval,
+	}
+}
+
+// Run syncs trees right away and then every interval until ctx is done.
+// Errors are logged and the sync is retried on the next tick.
+func (s *Syncer) Run(ctx context.Context) {
+	s.syncOnce(ctx)
+	if s.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.syncOnce(ctx)
+		}
+	}
+}
+
+func (s *Syncer) syncOnce(ctx context.Context) {
+	t1 := time.Now()
+	res, err := Sync(ctx, s.local, s.remote, s.roots)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Errorw("upstream sync failed", zap.Error(err))
+		}
+		return
+	}
+	for _, h := range res.Missing {
+		log.Warnf("node %v is missing upstream", h.Hex())
+	}
+	log.Infof("Synced %v nodes from upstream, %v fetched, in %v",
+		res.Nodes, res.Fetched, time.Since(t1))
+}
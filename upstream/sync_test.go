@@ -0,0 +1,126 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/go-merkletree-sql/db/memory"
+	"github.com/iden3/reverse-hash-service/hashdb"
+	rhshttp "github.com/iden3/reverse-hash-service/http"
+	"github.com/stretchr/testify/require"
+)
+
+var hashOne = merkletree.Hash{1}
+
+func treeNodes(t testing.TB, mt *merkletree.MerkleTree) []hashdb.Node {
+	var nodes []hashdb.Node
+	err := mt.Walk(context.Background(), nil, func(n *merkletree.Node) {
+		hash, err := n.Key()
+		require.NoError(t, err)
+		n2 := hashdb.Node{Hash: *hash}
+		switch n.Type {
+		case merkletree.NodeTypeMiddle:
+			n2.Children = append(n2.Children, *n.ChildL, *n.ChildR)
+		case merkletree.NodeTypeLeaf:
+			n2.Children = append(n2.Children,
+				*n.Entry[0], *n.Entry[1], hashOne)
+		case merkletree.NodeTypeEmpty:
+			return
+		default:
+			t.Fatalf("unexpected node type: %v", n.Type)
+		}
+		nodes = append(nodes, n2)
+	})
+	require.NoError(t, err)
+	return nodes
+}
+
+func newTree(t testing.TB, keys ...int64) *merkletree.MerkleTree {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 40)
+	require.NoError(t, err)
+	for _, k := range keys {
+		err = mt.Add(ctx, big.NewInt(k), big.NewInt(k*10))
+		require.NoError(t, err)
+	}
+	return mt
+}
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	mt := newTree(t, 1, 3, 5, 7, 10)
+	nodes := treeNodes(t, mt)
+	state := hashdb.Node{Children: []merkletree.Hash{
+		*mt.Root(), merkletree.HashZero, merkletree.HashZero}}
+	h, err := merkletree.HashElems(
+		state.Children[0].BigInt(), state.Children[1].BigInt(),
+		state.Children[2].BigInt())
+	require.NoError(t, err)
+	state.Hash = *h
+
+	remoteStorage := hashdb.NewMemory()
+	_, err = remoteStorage.SaveNodes(ctx, append(nodes, state))
+	require.NoError(t, err)
+	srv := httptest.NewServer(rhshttp.Handler(remoteStorage))
+	defer srv.Close()
+
+	// local storage already has a part of the tree
+	local := hashdb.NewMemory()
+	_, err = local.SaveNodes(ctx, nodes[:2])
+	require.NoError(t, err)
+
+	missingRoot := newTree(t, 2).Root()
+	res, err := Sync(ctx, local, NewClient(srv.URL+"/"),
+		[]merkletree.Hash{state.Hash, *missingRoot})
+	require.NoError(t, err)
+	require.Equal(t, len(nodes)+1, res.Nodes)
+	require.Equal(t, len(nodes)-1, res.Fetched)
+	require.Equal(t, []merkletree.Hash{*missingRoot}, res.Missing)
+
+	for _, n := range append(nodes, state) {
+		got, err := local.ByHash(ctx, n.Hash)
+		require.NoError(t, err)
+		require.Equal(t, n, got)
+	}
+
+	// second sync has nothing to fetch
+	res, err = Sync(ctx, local, NewClient(srv.URL),
+		[]merkletree.Hash{state.Hash})
+	require.NoError(t, err)
+	require.Equal(t, len(nodes)+1, res.Nodes)
+	require.Equal(t, 0, res.Fetched)
+	require.Empty(t, res.Missing)
+}
+
+func TestClient_ByHash_WrongNode(t *testing.T) {
+	ctx := context.Background()
+	mt := newTree(t, 1, 3)
+	nodes := treeNodes(t, mt)
+
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprintf(w,
+				`{"status":"OK","node":{"hash":"%v","children":["%v","%v"]}}`,
+				nodes[0].Hash.Hex(), nodes[0].Children[0].Hex(),
+				nodes[0].Children[1].Hex())
+		}))
+	defer srv.Close()
+
+	other := *newTree(t, 2).Root()
+	_, err := NewClient(srv.URL).ByHash(ctx, other)
+	require.EqualError(t, err, fmt.Sprintf(
+		"upstream returned node %v instead of %v",
+		nodes[0].Hash.Hex(), other.Hex()))
+
+	local := hashdb.NewMemory()
+	_, err = Sync(ctx, local, NewClient(srv.URL),
+		[]merkletree.Hash{other})
+	require.Error(t, err)
+	_, err = local.ByHash(ctx, nodes[0].Hash)
+	require.ErrorIs(t, err, hashdb.ErrDoesNotExists)
+}